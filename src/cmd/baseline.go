@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"com.bradleytenuta/idiot/internal/history"
+	"com.bradleytenuta/idiot/internal/model"
+	"com.bradleytenuta/idiot/internal/store"
+)
+
+// baselineListOutput holds the value of the --output flag of the baseline list command.
+var baselineListOutput string
+
+// init registers the baseline command and its subcommands with the root command.
+func init() {
+	rootCmd.AddCommand(baselineCmd)
+	baselineCmd.AddCommand(baselineSaveCmd, baselineListCmd, baselineAddCmd, baselineRmCmd)
+	baselineListCmd.Flags().StringVarP(&baselineListOutput, "output", "o", "", "print the baseline in this format instead of a table, one of: "+strings.Join(devicesFormats, ", "))
+}
+
+var baselineCmd = &cobra.Command{
+	Use:   "baseline",
+	Short: "Manage the baseline of devices known to belong on the network.",
+	Long: `Manage the baseline of devices known to belong on the network, kept in the configuration file. Each entry
+has any of a MAC address, IPv4 address and hostname. 'idiot scan --against-baseline' flags every device that
+matches no entry, and exits with an error if it finds any or a discovery phase fails.`,
+}
+
+var baselineSaveCmd = &cobra.Command{
+	Use:   "save [scan]",
+	Short: "Replace the baseline with the devices found by a scan.",
+	Long: `Replace the baseline with the devices found by a saved scan, the latest one by default. Scans are given by
+their number or ID from the history command. Devices are added with their MAC address, IPv4 address and
+hostname, and are matched on the strongest of them that a scanned device has.`,
+	Example: "  idiot scan -o table && idiot baseline save\n  idiot baseline save 3",
+	Args:    cobra.MaximumNArgs(1),
+	Run:     runBaselineSave,
+}
+
+var baselineListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List the baseline.",
+	Example: "  idiot baseline list -o json",
+	Args:    cobra.NoArgs,
+	Run:     runBaselineList,
+}
+
+var baselineAddCmd = &cobra.Command{
+	Use:     "add <mac|address|hostname>...",
+	Short:   "Add devices to the baseline.",
+	Example: "  idiot baseline add b8:27:eb:12:34:56 printer 192.168.1.1",
+	Args:    cobra.MinimumNArgs(1),
+	Run:     runBaselineAdd,
+}
+
+var baselineRmCmd = &cobra.Command{
+	Use:     "rm <mac|address|hostname>...",
+	Aliases: []string{"remove"},
+	Short:   "Remove devices from the baseline.",
+	Example: "  idiot baseline rm printer",
+	Args:    cobra.MinimumNArgs(1),
+	Run:     runBaselineRm,
+}
+
+// runBaselineSave replaces the baseline with the devices of a saved scan.
+func runBaselineSave(cmd *cobra.Command, args []string) {
+	ref := "latest"
+	if len(args) > 0 {
+		ref = args[0]
+	}
+	scans, err := history.DefaultStore()
+	if err != nil {
+		log.Error().Msgf("Failed to read scan history: %v", err)
+		os.Exit(1)
+	}
+	scan, err := scans.Get(ref)
+	if err != nil {
+		log.Error().Msgf("Failed to read scan, run 'idiot scan' first: %v", err)
+		os.Exit(1)
+	}
+
+	entries := make([]model.BaselineEntry, 0, len(scan.Devices))
+	for _, device := range scan.Devices {
+		entries = append(entries, model.NewBaselineEntry(device))
+	}
+	if err := store.Baseline().Save(entries); err != nil {
+		log.Error().Msgf("Failed to save the baseline: %v", err)
+		os.Exit(1)
+	}
+	log.Info().Msgf("Saved %d devices from scan %s as the baseline.", len(scan.Devices), scan.ID)
+}
+
+// runBaselineList prints the baseline.
+func runBaselineList(cmd *cobra.Command, args []string) {
+	if baselineListOutput != "" && !slices.Contains(devicesFormats, baselineListOutput) {
+		log.Error().Msgf("Invalid output format '%s', expected one of: %s", baselineListOutput, strings.Join(devicesFormats, ", "))
+		os.Exit(1)
+	}
+	entries, err := store.Baseline().List()
+	if err != nil {
+		log.Error().Msgf("Failed to read the baseline: %v", err)
+		os.Exit(1)
+	}
+
+	if baselineListOutput != "" {
+		if entries == nil {
+			entries = []model.BaselineEntry{}
+		}
+		err = writeDevicesAs(cmd.OutOrStdout(), baselineListOutput, entries)
+	} else if len(entries) == 0 {
+		log.Info().Msg("The baseline is empty, run 'idiot baseline save' or 'idiot baseline add' first.")
+	} else {
+		err = writeBaselineTable(cmd.OutOrStdout(), entries)
+	}
+	if err != nil {
+		log.Error().Msgf("Failed to write the baseline: %v", err)
+		os.Exit(1)
+	}
+}
+
+// runBaselineAdd adds each of the given MAC addresses, IPv4 addresses and hostnames to the baseline.
+func runBaselineAdd(cmd *cobra.Command, args []string) {
+	for _, ref := range args {
+		entry := model.ParseBaselineEntry(strings.TrimSpace(ref))
+		added, err := store.Baseline().Add(entry)
+		if err != nil {
+			log.Error().Msgf("Failed to add to the baseline: %v", err)
+			os.Exit(1)
+		}
+		if added {
+			log.Info().Msgf("Added %s to the baseline.", entry)
+		} else {
+			log.Info().Msgf("%s is already in the baseline.", entry)
+		}
+	}
+}
+
+// runBaselineRm removes each of the given entries from the baseline. It exits with 1 if any could not be removed.
+func runBaselineRm(cmd *cobra.Command, args []string) {
+	failed := false
+	for _, ref := range args {
+		entry, err := store.Baseline().Remove(ref)
+		if err != nil {
+			log.Error().Msgf("Failed to remove from the baseline: %v", err)
+			failed = true
+			continue
+		}
+		log.Info().Msgf("Removed %s from the baseline.", entry)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// writeBaselineTable writes one row per baseline entry, showing "-" for the fields it does not match on.
+func writeBaselineTable(w io.Writer, entries []model.BaselineEntry) error {
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "MAC\tADDRV4\tHOSTNAME")
+	for _, entry := range entries {
+		row := []string{entry.MAC, entry.AddrV4, entry.Hostname}
+		for i, field := range row {
+			if field == "" {
+				row[i] = "-"
+			}
+		}
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,284 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"com.bradleytenuta/idiot/internal/model"
+	"com.bradleytenuta/idiot/internal/output"
+	"com.bradleytenuta/idiot/internal/store"
+)
+
+var (
+	// devicesListOutput and devicesShowOutput hold the values of the --output flags of the list and show commands.
+	devicesListOutput string
+	devicesShowOutput string
+	// devicesTag limits the list command to devices with this tag.
+	devicesTag string
+	// devicesSetUser, devicesSetPort, devicesSetIdentity and devicesSetJump hold the flags of the set command.
+	// Only the flags that are given are changed.
+	devicesSetUser     string
+	devicesSetPort     int
+	devicesSetIdentity string
+	devicesSetJump     []string
+)
+
+// devicesFormats lists the supported values of the --output flag of the list and show commands.
+var devicesFormats = []string{"json", "yaml"}
+
+// init registers the devices command and its subcommands with the root command.
+func init() {
+	rootCmd.AddCommand(devicesCmd)
+	devicesCmd.AddCommand(devicesListCmd, devicesShowCmd, devicesRmCmd, devicesRenameCmd, devicesTagCmd, devicesUntagCmd, devicesSetCmd)
+
+	devicesListCmd.Flags().StringVarP(&devicesListOutput, "output", "o", "", "print the devices in this format instead of a table, one of: "+strings.Join(devicesFormats, ", "))
+	devicesListCmd.Flags().StringVar(&devicesTag, "tag", "", "only list devices with this tag")
+	devicesShowCmd.Flags().StringVarP(&devicesShowOutput, "output", "o", "yaml", "format to print the device in, one of: "+strings.Join(devicesFormats, ", "))
+
+	devicesSetCmd.Flags().StringVarP(&devicesSetUser, "user", "l", "", "username to log in as")
+	devicesSetCmd.Flags().IntVarP(&devicesSetPort, "port", "p", 0, "SSH port of the device")
+	devicesSetCmd.Flags().StringVarP(&devicesSetIdentity, "identity", "i", "", "private key file to log in with")
+	devicesSetCmd.Flags().StringSliceVarP(&devicesSetJump, "jump", "J", nil, "jump hosts to connect through, in order; the first is reached through its own jump hosts (repeatable)")
+}
+
+var devicesCmd = &cobra.Command{
+	Use:   "devices",
+	Short: "Manage the saved IOT devices.",
+	Long: `List, inspect and edit the IOT devices saved in the configuration file. Devices are given by their
+IPv4 address, alias, hostname or MAC address.`,
+}
+
+var devicesListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List the saved IOT devices.",
+	Example: "  idiot devices list --tag garage\n  idiot devices list -o json",
+	Args:    cobra.NoArgs,
+	Run:     runDevicesList,
+}
+
+var devicesShowCmd = &cobra.Command{
+	Use:     "show <device>",
+	Short:   "Show everything saved about an IOT device.",
+	Example: "  idiot devices show garage-pi -o json",
+	Args:    cobra.ExactArgs(1),
+	Run:     runDevicesShow,
+}
+
+var devicesRmCmd = &cobra.Command{
+	Use:     "rm <device>...",
+	Aliases: []string{"remove"},
+	Short:   "Remove saved IOT devices.",
+	Example: "  idiot devices rm 192.168.1.20",
+	Args:    cobra.MinimumNArgs(1),
+	Run:     runDevicesRm,
+}
+
+var devicesRenameCmd = &cobra.Command{
+	Use:   "rename <device> <alias>",
+	Short: "Give a saved IOT device an alias.",
+	Long: `Give a saved IOT device an alias, which can be used to refer to it in every command and is shown in
+place of its hostname. An empty alias removes it. An alias cannot be the address or name of another saved device.`,
+	Example: "  idiot devices rename 192.168.1.20 garage-pi\n  idiot devices rename garage-pi ''",
+	Args:    cobra.ExactArgs(2),
+	Run:     runDevicesRename,
+}
+
+var devicesTagCmd = &cobra.Command{
+	Use:     "tag <device> <tag>...",
+	Short:   "Add tags to a saved IOT device.",
+	Example: "  idiot devices tag garage-pi garage sensors",
+	Args:    cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runDevicesTag(cmd, args, true)
+	},
+}
+
+var devicesUntagCmd = &cobra.Command{
+	Use:     "untag <device> <tag>...",
+	Short:   "Remove tags from a saved IOT device.",
+	Example: "  idiot devices untag garage-pi sensors",
+	Args:    cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runDevicesTag(cmd, args, false)
+	},
+}
+
+var devicesSetCmd = &cobra.Command{
+	Use:   "set <device>",
+	Short: "Change how idiot connects to a saved IOT device.",
+	Long: `Change the username, SSH port, identity file or jump hosts saved for an IOT device. Only the flags that
+are given are changed, and an empty value removes the setting.`,
+	Example: "  idiot devices set garage-pi --user pi --port 2222 --identity ~/.ssh/pi_ed25519\n  idiot devices set garage-pi --jump ''",
+	Args:    cobra.ExactArgs(1),
+	Run:     runDevicesSet,
+}
+
+// runDevicesList prints the saved devices, optionally only those with the --tag tag.
+func runDevicesList(cmd *cobra.Command, args []string) {
+	if devicesListOutput != "" && !slices.Contains(devicesFormats, devicesListOutput) {
+		log.Error().Msgf("Invalid output format '%s', expected one of: %s", devicesListOutput, strings.Join(devicesFormats, ", "))
+		os.Exit(1)
+	}
+	devices, err := store.Devices().List()
+	if err != nil {
+		log.Error().Msgf("Failed to read saved devices: %v", err)
+		os.Exit(1)
+	}
+	if devicesTag != "" {
+		devices = slices.DeleteFunc(devices, func(device model.Device) bool {
+			return !device.HasTag(devicesTag)
+		})
+	}
+
+	if devices == nil {
+		devices = []model.Device{}
+	}
+	if devicesListOutput != "" {
+		err = writeDevicesAs(cmd.OutOrStdout(), devicesListOutput, devices)
+	} else {
+		err = output.WriteSavedDevices(cmd.OutOrStdout(), devices)
+	}
+	if err != nil {
+		log.Error().Msgf("Failed to write devices: %v", err)
+		os.Exit(1)
+	}
+}
+
+// runDevicesShow prints every field of a saved device.
+func runDevicesShow(cmd *cobra.Command, args []string) {
+	if !slices.Contains(devicesFormats, devicesShowOutput) {
+		log.Error().Msgf("Invalid output format '%s', expected one of: %s", devicesShowOutput, strings.Join(devicesFormats, ", "))
+		os.Exit(1)
+	}
+	device, err := store.Devices().Get(args[0])
+	if err != nil {
+		log.Error().Msgf("Failed to show device: %v", err)
+		os.Exit(1)
+	}
+	if err := writeDevicesAs(cmd.OutOrStdout(), devicesShowOutput, device); err != nil {
+		log.Error().Msgf("Failed to write device: %v", err)
+		os.Exit(1)
+	}
+}
+
+// runDevicesRm removes each of the given devices. It exits with 1 if any could not be removed.
+func runDevicesRm(cmd *cobra.Command, args []string) {
+	failed := false
+	for _, ref := range args {
+		device, err := store.Devices().Remove(ref)
+		if err != nil {
+			log.Error().Msgf("Failed to remove device: %v", err)
+			failed = true
+			continue
+		}
+		log.Info().Msgf("Removed %s.", device.Name())
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// runDevicesRename sets the alias of a device.
+func runDevicesRename(cmd *cobra.Command, args []string) {
+	alias := strings.TrimSpace(args[1])
+	device, err := store.Devices().Update(args[0], func(device *model.Device) error {
+		device.Alias = alias
+		return nil
+	})
+	if err != nil {
+		log.Error().Msgf("Failed to rename device: %v", err)
+		os.Exit(1)
+	}
+	if alias == "" {
+		log.Info().Msgf("Removed the alias of %s.", device.AddrV4)
+	} else {
+		log.Info().Msgf("%s is now known as %s.", device.AddrV4, alias)
+	}
+}
+
+// runDevicesTag adds the tags to a device, or removes them when add is false. Tags are compared
+// ignoring case, so adding a tag the device already has does nothing.
+func runDevicesTag(cmd *cobra.Command, args []string, add bool) {
+	tags := args[1:]
+	device, err := store.Devices().Update(args[0], func(device *model.Device) error {
+		for _, tag := range tags {
+			if tag == "" || strings.ContainsAny(tag, ", \t") {
+				return fmt.Errorf("invalid tag '%s', it must not be empty or contain commas or spaces", tag)
+			}
+			if add && !device.HasTag(tag) {
+				device.Tags = append(device.Tags, tag)
+			} else if !add {
+				device.Tags = slices.DeleteFunc(device.Tags, func(t string) bool {
+					return strings.EqualFold(t, tag)
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error().Msgf("Failed to tag device: %v", err)
+		os.Exit(1)
+	}
+	log.Info().Msgf("Tags of %s: %s", device.Name(), strings.Join(device.Tags, ", "))
+}
+
+// runDevicesSet changes the connection settings of a device given by the set command's flags.
+func runDevicesSet(cmd *cobra.Command, args []string) {
+	flags := cmd.Flags()
+	if flags.NFlag() == 0 {
+		log.Error().Msg("Nothing to change, use --user, --port, --identity or --jump.")
+		os.Exit(1)
+	}
+	device, err := store.Devices().Update(args[0], func(device *model.Device) error {
+		if flags.Changed("user") {
+			device.User = devicesSetUser
+		}
+		if flags.Changed("port") {
+			if devicesSetPort < 0 || devicesSetPort > 65535 {
+				return fmt.Errorf("invalid port %d", devicesSetPort)
+			}
+			device.SSHPort = devicesSetPort
+		}
+		if flags.Changed("identity") {
+			device.IdentityFile = devicesSetIdentity
+		}
+		if flags.Changed("jump") {
+			device.JumpHosts = slices.DeleteFunc(devicesSetJump, func(jumpHost string) bool {
+				return jumpHost == ""
+			})
+			if slices.ContainsFunc(device.JumpHosts, func(jumpHost string) bool {
+				return model.FindDevice([]model.Device{*device}, jumpHost) != nil
+			}) {
+				return errors.New("a device cannot be its own jump host")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error().Msgf("Failed to change device: %v", err)
+		os.Exit(1)
+	}
+	log.Info().Msgf("Saved the settings of %s.", device.Name())
+}
+
+// writeDevicesAs writes a device, or a list of devices, to w as JSON or YAML using the model.Device schema.
+func writeDevicesAs(w io.Writer, format string, value any) error {
+	if format == "json" {
+		return writeJSON(w, value)
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
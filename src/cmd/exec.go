@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// execFailedStatus is the exit status used when the command could not be run on the device,
+// matching OpenSSH so scripts can tell connection failures apart from the command failing.
+const execFailedStatus = 255
+
+// execUser holds the value of the --user flag, which overrides the username saved for the device.
+var execUser string
+
+// init registers the exec command with the root command.
+func init() {
+	rootCmd.AddCommand(execCmd)
+	execCmd.Flags().StringVarP(&execUser, "user", "l", "", "username to log in as, overriding the one saved for the device")
+}
+
+var execCmd = &cobra.Command{
+	Use:   "exec <device> -- <command>",
+	Short: "Run a command on a saved IOT device.",
+	Long: `Run a command on one of the saved IOT devices without opening a shell. The device can be given by its
+IPv4 address, alias, hostname, MAC address or a Host alias from ~/.ssh/config. The command's output and errors are streamed to stdout and stderr,
+and idiot exits with the command's exit status, or 255 if it could not be run.`,
+	Example: "  idiot exec 192.168.1.20 -- cat /etc/os-release",
+	Args:    cobra.MinimumNArgs(2),
+	Run:     runExec,
+}
+
+// runExec connects to the saved device and runs the command, exiting with its exit status.
+func runExec(cmd *cobra.Command, args []string) {
+	status, err := execCommand(cmd, args[0], strings.Join(args[1:], " "))
+	if err != nil {
+		log.Error().Msgf("Failed to run command: %v", err)
+	}
+	os.Exit(status)
+}
+
+// execCommand runs the command on the device and returns its exit status. No PTY is requested,
+// so it works from scripts and pipes. Standard input is forwarded when it is not a terminal,
+// letting data be piped to the remote command.
+func execCommand(cmd *cobra.Command, deviceRef, command string) (int, error) {
+	device, err := chooseDevice(deviceRef)
+	if err != nil {
+		return execFailedStatus, err
+	}
+	if execUser != "" {
+		device.User = execUser
+	}
+	if configured, _ := withSSHConfig(device); configured.User == "" && !term.IsTerminal(int(os.Stdin.Fd())) {
+		return execFailedStatus, fmt.Errorf("no username is saved for '%s', use --user", deviceRef)
+	}
+
+	client, err := connectDevice(device)
+	if err != nil {
+		return execFailedStatus, err
+	}
+	defer client.Close()
+
+	// The session waits for standard input to close before it finishes, so a terminal is not forwarded.
+	var stdin io.Reader
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		stdin = os.Stdin
+	}
+	return runRemoteCommand(client, command, stdin, cmd.OutOrStdout(), cmd.ErrOrStderr())
+}
+
+// runRemoteCommand runs the command in a new session without a PTY, streaming its output to stdout
+// and stderr, and returns its exit status. A command killed by a signal is reported as an error.
+func runRemoteCommand(client *ssh.Client, command string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return execFailedStatus, err
+	}
+	defer session.Close()
+
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	err = session.Run(command)
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		return 0, nil
+	case errors.As(err, &exitErr):
+		if exitErr.Signal() != "" {
+			return execFailedStatus, fmt.Errorf("remote command was killed by signal %s", exitErr.Signal())
+		}
+		return exitErr.ExitStatus(), nil
+	default:
+		return execFailedStatus, err
+	}
+}
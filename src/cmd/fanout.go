@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"com.bradleytenuta/idiot/internal/model"
+	"com.bradleytenuta/idiot/internal/output"
+	"com.bradleytenuta/idiot/internal/store"
+)
+
+var (
+	// fanoutDevices and fanoutMatch select which saved devices to run on. When both are empty, every saved device is used.
+	fanoutDevices []string
+	fanoutMatch   string
+	// fanoutUser overrides the username saved for each device.
+	fanoutUser string
+	// fanoutConcurrency limits how many devices are connected to at once.
+	fanoutConcurrency int
+	// fanoutTimeout limits how long each device has to connect and run the command.
+	fanoutTimeout time.Duration
+	// fanoutOutput holds the value of the --output flag. When empty, output is streamed with a prefix per device.
+	fanoutOutput string
+)
+
+// init registers the fanout command with the root command.
+func init() {
+	rootCmd.AddCommand(fanoutCmd)
+	fanoutCmd.Flags().StringSliceVarP(&fanoutDevices, "devices", "d", nil, "saved devices to run on, by IPv4 address, alias, hostname or MAC address (repeatable)")
+	fanoutCmd.Flags().StringVar(&fanoutMatch, "match", "", "only run on saved devices whose alias, hostname or IPv4 address matches this glob, e.g. 'pi-*'")
+	fanoutCmd.Flags().StringVarP(&fanoutUser, "user", "l", "", "username to log in as, overriding the one saved for each device")
+	fanoutCmd.Flags().IntVarP(&fanoutConcurrency, "concurrency", "c", 10, "maximum number of devices to run on at once")
+	fanoutCmd.Flags().DurationVar(&fanoutTimeout, "timeout", 60*time.Second, "maximum time for each device to connect and run the command")
+	fanoutCmd.Flags().StringVarP(&fanoutOutput, "output", "o", "", "print a summary of every device in this format instead of streaming the output, one of: json")
+}
+
+var fanoutCmd = &cobra.Command{
+	Use:   "fanout -- <command>",
+	Short: "Run a command on many saved IOT devices at once.",
+	Long: `Run the same command concurrently on every saved IOT device, or on those selected with --devices or --match.
+Each line of output is prefixed with the device it came from, or with --output json a summary of every device's
+output, exit status, duration and error is printed once all have finished. idiot exits with 1 if the command
+failed on any device.`,
+	Example: "  idiot fanout --match 'pi-*' --concurrency 20 -- sudo apt-get upgrade -y",
+	Args:    cobra.MinimumNArgs(1),
+	Run:     runFanout,
+}
+
+// fanoutResult is the outcome of running the command on a single device.
+type fanoutResult struct {
+	Device     string `json:"device"`
+	Hostname   string `json:"hostname,omitempty"`
+	ExitStatus int    `json:"exitStatus"`
+	DurationMs int64  `json:"durationMs"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	Error      string `json:"error,omitempty"`
+}
+
+// runFanout runs the command on the selected devices, with at most fanoutConcurrency running at once.
+func runFanout(cmd *cobra.Command, args []string) {
+	if fanoutOutput != "" && fanoutOutput != "json" {
+		log.Error().Msgf("Invalid output format '%s', expected: json", fanoutOutput)
+		os.Exit(1)
+	}
+	saved, err := store.Devices().List()
+	if err != nil {
+		log.Error().Msgf("Failed to read saved devices: %v", err)
+		os.Exit(1)
+	}
+	devices, err := selectFanoutDevices(saved, fanoutDevices, fanoutMatch)
+	if err != nil {
+		log.Error().Msgf("Failed to select devices: %v", err)
+		os.Exit(1)
+	}
+	command := strings.Join(args, " ")
+
+	results := make([]fanoutResult, len(devices))
+	labelWidth := 0
+	for _, device := range devices {
+		labelWidth = max(labelWidth, len(device.Name()))
+	}
+
+	var outMu, errMu sync.Mutex
+	semaphore := make(chan struct{}, max(fanoutConcurrency, 1))
+	var wg sync.WaitGroup
+	for i, device := range devices {
+		wg.Add(1)
+		go func(i int, device model.Device) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			if fanoutOutput == "json" {
+				var stdout, stderr bytes.Buffer
+				results[i] = runOnDevice(device, command, &stdout, &stderr)
+				results[i].Stdout = stdout.String()
+				results[i].Stderr = stderr.String()
+				return
+			}
+
+			prefix := fmt.Sprintf("[%-*s] ", labelWidth, device.Name())
+			stdout := output.NewPrefixWriter(cmd.OutOrStdout(), &outMu, prefix)
+			stderr := output.NewPrefixWriter(cmd.ErrOrStderr(), &errMu, prefix)
+			results[i] = runOnDevice(device, command, stdout, stderr)
+			_ = stdout.Flush()
+			_ = stderr.Flush()
+			if results[i].Error != "" {
+				log.Error().Msgf("%s: %s", device.Name(), results[i].Error)
+			} else if results[i].ExitStatus != 0 {
+				log.Error().Msgf("%s: exited with status %d", device.Name(), results[i].ExitStatus)
+			}
+		}(i, device)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" || result.ExitStatus != 0 {
+			failed++
+		}
+	}
+	if fanoutOutput == "json" {
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(results); err != nil {
+			log.Error().Msgf("Failed to write results: %v", err)
+		}
+	} else {
+		log.Info().Msgf("Finished on %d devices, %d failed.", len(results), failed)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// selectFanoutDevices returns the saved devices named in refs and matching the glob pattern.
+// Every saved device is returned when neither is given.
+func selectFanoutDevices(saved []model.Device, refs []string, pattern string) ([]model.Device, error) {
+	if pattern != "" {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+	}
+
+	candidates := saved
+	if len(refs) > 0 {
+		candidates = nil
+		for _, ref := range refs {
+			device := model.FindDevice(saved, ref)
+			if device == nil {
+				return nil, fmt.Errorf("no saved device matches '%s'", ref)
+			}
+			candidates = append(candidates, *device)
+		}
+	}
+
+	var selected []model.Device
+	for _, device := range candidates {
+		if pattern != "" {
+			aliasMatch, _ := path.Match(pattern, device.Alias)
+			hostnameMatch, _ := path.Match(pattern, device.Hostname)
+			addrMatch, _ := path.Match(pattern, device.AddrV4)
+			if !aliasMatch && !hostnameMatch && !addrMatch {
+				continue
+			}
+		}
+		selected = append(selected, device)
+	}
+	if len(selected) == 0 {
+		return nil, errors.New("no saved devices to run on")
+	}
+	return selected, nil
+}
+
+// runOnDevice connects to the device and runs the command, giving up once fanoutTimeout has passed.
+// The user is never prompted for a username, as that would stall every other device.
+func runOnDevice(device model.Device, command string, stdout, stderr io.Writer) (result fanoutResult) {
+	start := time.Now()
+	result = fanoutResult{Device: device.AddrV4, Hostname: device.Hostname, ExitStatus: execFailedStatus}
+	defer func() { result.DurationMs = time.Since(start).Milliseconds() }()
+
+	if fanoutUser != "" {
+		device.User = fanoutUser
+	}
+	if configured, _ := withSSHConfig(&device); configured.User == "" {
+		result.Error = "no username is saved for the device or set in ~/.ssh/config, use --user"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fanoutTimeout)
+	defer cancel()
+	// A command that is still being stopped after the timeout must not write over the result.
+	stdoutCutoff, stderrCutoff := &cutoffWriter{w: stdout}, &cutoffWriter{w: stderr}
+	defer stdoutCutoff.cutOff()
+	defer stderrCutoff.cutOff()
+
+	type outcome struct {
+		status int
+		err    error
+	}
+	outcomes := make(chan outcome, 1)
+	go func() {
+		client, err := connectDevice(&device)
+		if err != nil {
+			outcomes <- outcome{execFailedStatus, err}
+			return
+		}
+		defer client.Close()
+		// Closing the client ends a command that is still running when the timeout expires.
+		stop := context.AfterFunc(ctx, func() { _ = client.Close() })
+		defer stop()
+		status, err := runRemoteCommand(client, command, nil, stdoutCutoff, stderrCutoff)
+		outcomes <- outcome{status, err}
+	}()
+
+	select {
+	case o := <-outcomes:
+		result.ExitStatus = o.status
+		if o.err != nil {
+			result.Error = o.err.Error()
+		}
+	case <-ctx.Done():
+		result.Error = fmt.Sprintf("timed out after %s", fanoutTimeout)
+	}
+	return result
+}
+
+// cutoffWriter passes writes through to w until it is cut off, after which they are discarded.
+type cutoffWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	cut bool
+}
+
+// Write writes p to the underlying writer, unless the writer has been cut off.
+func (c *cutoffWriter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cut {
+		return len(p), nil
+	}
+	return c.w.Write(p)
+}
+
+// cutOff discards every later write.
+func (c *cutoffWriter) cutOff() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cut = true
+}
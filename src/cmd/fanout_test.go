@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"testing"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// TestSelectFanoutDevices verifies that devices can be selected by name and by glob.
+func TestSelectFanoutDevices(t *testing.T) {
+	saved := []model.Device{
+		{AddrV4: "192.168.1.10", Hostname: "pi-kitchen"},
+		{AddrV4: "192.168.1.11", Hostname: "pi-garage"},
+		{AddrV4: "192.168.1.20", Hostname: "printer", Alias: "office-printer"},
+	}
+
+	tests := []struct {
+		name    string
+		refs    []string
+		pattern string
+		want    []string
+		wantErr bool
+	}{
+		{name: "all", want: []string{"192.168.1.10", "192.168.1.11", "192.168.1.20"}},
+		{name: "hostname glob", pattern: "pi-*", want: []string{"192.168.1.10", "192.168.1.11"}},
+		{name: "alias glob", pattern: "office-*", want: []string{"192.168.1.20"}},
+		{name: "address glob", pattern: "192.168.1.2?", want: []string{"192.168.1.20"}},
+		{name: "refs", refs: []string{"printer", "192.168.1.11"}, want: []string{"192.168.1.20", "192.168.1.11"}},
+		{name: "refs and glob", refs: []string{"printer", "pi-garage"}, pattern: "pi-*", want: []string{"192.168.1.11"}},
+		{name: "unknown ref", refs: []string{"tv"}, wantErr: true},
+		{name: "no match", pattern: "camera-*", wantErr: true},
+		{name: "invalid glob", pattern: "[", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectFanoutDevices(saved, tt.refs, tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectFanoutDevices() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("selectFanoutDevices() returned %d devices, want %d", len(got), len(tt.want))
+			}
+			for i, device := range got {
+				if device.AddrV4 != tt.want[i] {
+					t.Errorf("device %d = %s, want %s", i, device.AddrV4, tt.want[i])
+				}
+			}
+		})
+	}
+}
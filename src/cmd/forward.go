@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"com.bradleytenuta/idiot/internal/network"
+	"com.bradleytenuta/idiot/internal/ui"
+)
+
+var (
+	// forwardDevice selects the saved device to forward through. When empty, the user is asked to select one.
+	forwardDevice string
+	// forwardLocal, forwardRemote and forwardDynamic hold the -L, -R and -D rules.
+	forwardLocal   []string
+	forwardRemote  []string
+	forwardDynamic []string
+)
+
+// init registers the forward command with the root command.
+func init() {
+	rootCmd.AddCommand(forwardCmd)
+	forwardCmd.Flags().StringVarP(&forwardDevice, "device", "d", "", "saved device to forward through, by IPv4 address, alias, hostname or MAC address, instead of selecting one")
+	forwardCmd.Flags().StringArrayVarP(&forwardLocal, "local", "L", nil, "forward a local port to an address reachable from the device, [bind_address:]port:host:hostport (repeatable)")
+	forwardCmd.Flags().StringArrayVarP(&forwardRemote, "remote", "R", nil, "forward a port on the device to an address reachable from here, [bind_address:]port:host:hostport (repeatable)")
+	forwardCmd.Flags().StringArrayVarP(&forwardDynamic, "dynamic", "D", nil, "run a SOCKS5 proxy on a local port that connects through the device, [bind_address:]port (repeatable)")
+}
+
+var forwardCmd = &cobra.Command{
+	Use:   "forward",
+	Short: "Forward ports through a saved IOT device.",
+	Long: `Forward ports through one of the saved IOT devices over SSH, until Ctrl+C is pressed. Local forwards (-L) reach
+web UIs that a device only serves on localhost, or devices behind a gateway. Remote forwards (-R) let the device reach
+a service on this machine. Dynamic forwards (-D) run a SOCKS5 proxy, so a browser can reach everything the device can.`,
+	Example: "  idiot forward -L 8080:localhost:80\n  idiot forward -d gateway -D 1080 -L 8443:192.168.50.10:443",
+	Args:    cobra.NoArgs,
+	Run:     runForward,
+}
+
+// runForward connects to the chosen device and forwards the ports until interrupted or the connection drops.
+func runForward(cmd *cobra.Command, args []string) {
+	defer ui.InitTerminal()()
+	if err := forwardPorts(); err != nil {
+		log.Error().Msgf("Failed to forward ports: %v", err)
+		os.Exit(1)
+	}
+}
+
+// forwardPorts parses the forwarding rules, connects to the device and runs the forwards.
+func forwardPorts() error {
+	rules := []struct {
+		kind  rune
+		specs []string
+	}{
+		{network.ForwardLocal, forwardLocal},
+		{network.ForwardRemote, forwardRemote},
+		{network.ForwardDynamic, forwardDynamic},
+	}
+	var forwards []network.Forward
+	for _, rule := range rules {
+		for _, spec := range rule.specs {
+			forward, err := network.ParseForward(rule.kind, spec)
+			if err != nil {
+				return err
+			}
+			forwards = append(forwards, forward)
+		}
+	}
+	if len(forwards) == 0 {
+		return errors.New("no forwards given, use -L, -R or -D")
+	}
+
+	device, err := chooseDevice(forwardDevice)
+	if err != nil {
+		return err
+	}
+	client, err := connectDevice(device)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	// Stop on Ctrl+C, or when the device closes the connection.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancelCause(ctx)
+	errConnectionClosed := errors.New("connection to the device was closed")
+	go func() {
+		_ = client.Wait()
+		cancel(errConnectionClosed)
+	}()
+
+	if err := network.RunForwards(ctx, client, forwards); err != nil {
+		return err
+	}
+	if errors.Is(context.Cause(ctx), errConnectionClosed) {
+		return errConnectionClosed
+	}
+	log.Info().Msg("Stopped forwarding.")
+	return nil
+}
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"com.bradleytenuta/idiot/internal/history"
+)
+
+var (
+	// historyOutput and diffOutput hold the values of the --output flags. When empty, a summary for people is printed.
+	historyOutput string
+	diffOutput    string
+)
+
+// init registers the history and diff commands with the root command.
+func init() {
+	rootCmd.AddCommand(historyCmd, diffCmd)
+	historyCmd.Flags().StringVarP(&historyOutput, "output", "o", "", "print every scan and its devices in this format instead of a table, one of: json")
+	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", "", "print the differences in this format, one of: json")
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List previous scans.",
+	Long: `List the scans saved by the scan command, oldest first. Scans are numbered from 1, and the number or
+ID of a scan can be given to the diff command.`,
+	Args: cobra.NoArgs,
+	Run:  runHistory,
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [scanA] [scanB]",
+	Short: "Show what changed on the network between two scans.",
+	Long: `Compare two saved scans, listing the devices that appeared, disappeared, or changed IP address, hostname,
+open ports or services. Scans are given by their number or ID from the history command, or "latest".
+With no scans given, the two most recent scans are compared. With one, it is compared with the latest scan.`,
+	Example: "  idiot diff\n  idiot diff 3\n  idiot diff 3 5 -o json",
+	Args:    cobra.MaximumNArgs(2),
+	Run:     runDiff,
+}
+
+// runHistory prints a summary of every saved scan.
+func runHistory(cmd *cobra.Command, args []string) {
+	if historyOutput != "" && historyOutput != "json" {
+		log.Error().Msgf("Invalid output format '%s', expected: json", historyOutput)
+		os.Exit(1)
+	}
+	scans, err := history.DefaultStore()
+	if err != nil {
+		log.Error().Msgf("Failed to read scan history: %v", err)
+		os.Exit(1)
+	}
+	list, err := scans.List()
+	if err != nil {
+		log.Error().Msgf("Failed to read scan history: %v", err)
+		os.Exit(1)
+	}
+
+	if historyOutput == "json" {
+		if list == nil {
+			list = []history.Scan{}
+		}
+		err = writeJSON(cmd.OutOrStdout(), list)
+	} else if len(list) == 0 {
+		log.Info().Msg("No scans have been saved yet, run 'idiot scan' first.")
+	} else {
+		err = writeHistoryTable(cmd.OutOrStdout(), list)
+	}
+	if err != nil {
+		log.Error().Msgf("Failed to write scan history: %v", err)
+		os.Exit(1)
+	}
+}
+
+// runDiff compares two saved scans and prints the differences.
+func runDiff(cmd *cobra.Command, args []string) {
+	if diffOutput != "" && diffOutput != "json" {
+		log.Error().Msgf("Invalid output format '%s', expected: json", diffOutput)
+		os.Exit(1)
+	}
+	older, newer, err := diffScans(args)
+	if err != nil {
+		log.Error().Msgf("Failed to compare scans: %v", err)
+		os.Exit(1)
+	}
+
+	diffs := history.Diff(older, newer)
+	if diffOutput == "json" {
+		if diffs == nil {
+			diffs = []history.DeviceDiff{}
+		}
+		err = writeJSON(cmd.OutOrStdout(), diffs)
+	} else {
+		err = writeDiff(cmd.OutOrStdout(), older, newer, diffs)
+	}
+	if err != nil {
+		log.Error().Msgf("Failed to write differences: %v", err)
+		os.Exit(1)
+	}
+}
+
+// diffScans loads the two scans to compare from the diff command's arguments.
+func diffScans(args []string) (history.Scan, history.Scan, error) {
+	scans, err := history.DefaultStore()
+	if err != nil {
+		return history.Scan{}, history.Scan{}, err
+	}
+	refs := args
+	switch len(args) {
+	case 0:
+		ids, err := scans.IDs()
+		if err != nil {
+			return history.Scan{}, history.Scan{}, err
+		}
+		if len(ids) < 2 {
+			return history.Scan{}, history.Scan{}, fmt.Errorf("at least two saved scans are needed, found %d", len(ids))
+		}
+		refs = ids[len(ids)-2:]
+	case 1:
+		refs = []string{args[0], "latest"}
+	}
+
+	older, err := scans.Get(refs[0])
+	if err != nil {
+		return history.Scan{}, history.Scan{}, err
+	}
+	newer, err := scans.Get(refs[1])
+	if err != nil {
+		return history.Scan{}, history.Scan{}, err
+	}
+	return older, newer, nil
+}
+
+// writeHistoryTable writes one row per scan, numbered from 1 for the oldest.
+func writeHistoryTable(w io.Writer, scans []history.Scan) error {
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "#\tID\tTIME\tINTERFACE\tADDRESSES\tDEVICES\tDURATION")
+	for i, scan := range scans {
+		iface := scan.Interface
+		if iface == "" {
+			iface = "-"
+		}
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%d\t%d\t%s\n", i+1, scan.ID, scan.Time.Local().Format(time.DateTime), iface,
+			scan.Addresses, len(scan.Devices), (time.Duration(scan.DurationMs) * time.Millisecond).Round(100*time.Millisecond))
+	}
+	return writer.Flush()
+}
+
+// writeDiff writes one line per device that differs, marked "+" when it appeared, "-" when it
+// disappeared and "~" when it changed.
+func writeDiff(w io.Writer, older, newer history.Scan, diffs []history.DeviceDiff) error {
+	if _, err := fmt.Fprintf(w, "Comparing scan %s (%s) with scan %s (%s)\n", older.ID, older.Time.Local().Format(time.DateTime),
+		newer.ID, newer.Time.Local().Format(time.DateTime)); err != nil {
+		return err
+	}
+	if len(diffs) == 0 {
+		_, err := fmt.Fprintln(w, "No differences.")
+		return err
+	}
+
+	marks := map[string]string{history.Appeared: "+", history.Disappeared: "-", history.Changed: "~"}
+	for _, diff := range diffs {
+		name := diff.Device.Name()
+		if name != diff.Device.AddrV4 {
+			name += " (" + diff.Device.AddrV4 + ")"
+		}
+		line := fmt.Sprintf("%s %s %s", marks[diff.Kind], name, diff.Kind)
+		if len(diff.Changes) > 0 {
+			changes := make([]string, 0, len(diff.Changes))
+			for _, change := range diff.Changes {
+				changes = append(changes, change.String())
+			}
+			line += ": " + strings.Join(changes, ", ")
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJSON writes the value to w as indented JSON.
+func writeJSON(w io.Writer, value any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"com.bradleytenuta/idiot/internal/hooks"
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// init waits for hooks still running in the background before any command exits.
+func init() {
+	rootCmd.PersistentPostRun = func(cmd *cobra.Command, args []string) {
+		loadHooks().Wait()
+	}
+}
+
+// loadHooks returns the dispatcher for the hooks in the configuration file, which are read the first time they are needed.
+var loadHooks = sync.OnceValue(func() *hooks.Dispatcher {
+	var list []hooks.Hook
+	if err := viper.UnmarshalKey("hooks", &list); err != nil {
+		log.Error().Msgf("Failed to read hooks from the configuration file, ignoring them: %v", err)
+	}
+	return hooks.NewDispatcher(list)
+})
+
+// fireHook runs the hooks for the event about the device in the background.
+func fireHook(event string, device model.Device) {
+	loadHooks().Fire(hooks.Event{Event: event, Device: device})
+}
+
+// fireSessionEnded runs the hooks for the end of an SSH session to the device that started at start.
+func fireSessionEnded(device model.Device, start time.Time) {
+	loadHooks().Fire(hooks.Event{Event: hooks.SSHSessionEnded, Device: device, DurationMs: time.Since(start).Milliseconds()})
+}
@@ -48,6 +48,10 @@ func initConfig() {
 		}
 	}
 
+	if err := internal.SetConfigDefaults(); err != nil {
+		log.Error().Msgf("Error setting configuration defaults: %v", err)
+	}
+
 	viper.SetConfigFile(configFilePath)
 	viper.SetConfigType("yaml")
 	err := viper.ReadInConfig()
@@ -1,46 +1,206 @@
 package cmd
 
 import (
+	"maps"
+	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
-	"com.bradleytenuta/idiot/internal"
+	"com.bradleytenuta/idiot/internal/history"
+	"com.bradleytenuta/idiot/internal/hooks"
 	"com.bradleytenuta/idiot/internal/model"
 	"com.bradleytenuta/idiot/internal/network"
+	"com.bradleytenuta/idiot/internal/oui"
+	"com.bradleytenuta/idiot/internal/output"
+	"com.bradleytenuta/idiot/internal/store"
 	"com.bradleytenuta/idiot/internal/ui"
 )
 
+var (
+	// outputFormat holds the value of the --output flag. When empty, the interactive select is shown instead.
+	outputFormat string
+	// scanCIDRs, scanRanges and scanInterface select what to scan. When all are empty,
+	// the subnet of the internet-facing interface is scanned.
+	scanCIDRs     []string
+	scanRanges    []string
+	scanInterface string
+	// scanPorts overrides the scan_ports setting for a single scan.
+	scanPorts []int
+	// scanWatch, scanInterval and scanMissedRounds control watch mode, which scans on a loop and reports changes.
+	scanWatch        bool
+	scanInterval     time.Duration
+	scanMissedRounds int
+	// scanAgainstBaseline flags the devices that are not in the baseline, and makes the scan fail if there are any.
+	scanAgainstBaseline bool
+)
+
 // init registers the scan command with the root command.
 func init() {
 	rootCmd.AddCommand(scanCmd)
+	scanCmd.Flags().StringVarP(&outputFormat, "output", "o", "",
+		"print the discovered devices to stdout instead of prompting, one of: "+strings.Join(output.Formats, ", "))
+	scanCmd.Flags().StringSliceVar(&scanCIDRs, "cidr", nil, "IPv4 CIDR to scan, e.g. 192.168.1.0/24 (repeatable)")
+	scanCmd.Flags().StringSliceVar(&scanRanges, "range", nil, "inclusive IPv4 range to scan, e.g. 192.168.1.10-50 (repeatable)")
+	scanCmd.Flags().StringVarP(&scanInterface, "interface", "i", "", "network interface to scan from, e.g. eth1")
+	scanCmd.Flags().IntSliceVar(&scanPorts, "ports", nil, "TCP ports to probe on each device, overriding the scan_ports setting")
+	scanCmd.Flags().BoolVarP(&scanWatch, "watch", "w", false, "scan on a loop, printing an event whenever a device joins, leaves or changes address")
+	scanCmd.Flags().DurationVar(&scanInterval, "interval", 60*time.Second, "time between the start of each scan in watch mode")
+	scanCmd.Flags().IntVar(&scanMissedRounds, "missed-rounds", 3, "number of scans in a row a device must be missing from before it has left, in watch mode")
+	scanCmd.Flags().BoolVar(&scanAgainstBaseline, "against-baseline", false, "flag devices that are not in the baseline, exiting with 1 if any are found or a discovery phase fails")
 }
 
 var scanCmd = &cobra.Command{
 	Use:   "scan",
 	Short: "Scan the local network and list devices connected to it.",
-	Long:  `Scan the local network of this host and list the IP Addresses of devices connected to it. Including IPv4, IPv6 and if SSH is available.`,
-	Run:   runScan,
+	Long: `Scan the local network of this host and list the IP Addresses of devices connected to it. Including IPv4, IPv6, MAC and if SSH is available.
+With --watch, the network is scanned again every --interval until interrupted, and an event is printed whenever a device joins, leaves or changes address.
+With --against-baseline, devices that are not in the baseline are marked as unknown, and the command exits with 1 if any are found
+or a discovery phase fails, naming the phases that failed.`,
+	Example: "  idiot scan --output json\n  idiot scan --watch --interval 60s --cidr 10.20.0.0/24\n  idiot scan --against-baseline -o json",
+	Run:     runScan,
 }
 
-// runScan executes the network scan. It discovers devices using ICMP and mDNS,
-// then enriches the device data with SSH availability and reverse DNS lookups.
-// Finally, it presents an interactive list for the user to select a device to save.
+// runScan executes the network scan. It discovers devices using ICMP, ARP, mDNS and SSDP,
+// then enriches the device data with vendor names, open TCP ports, service banners, SSH host keys
+// and reverse DNS lookups. Saved devices found at a new address are updated, and the scan is added to the history.
+// Finally, it presents an interactive list for the user to select a device to save,
+// or prints every device in the format given by the --output flag.
 func runScan(cmd *cobra.Command, args []string) {
-	networkAddr, broadcastAddr, iface, err := network.GetInternetFacingNetworkInfo()
+	if outputFormat != "" && !output.IsValidFormat(outputFormat) {
+		log.Error().Msgf("Invalid output format '%s', expected one of: %s", outputFormat, strings.Join(output.Formats, ", "))
+		os.Exit(1)
+	}
+
+	target, err := network.ResolveScanTarget(scanCIDRs, scanRanges, scanInterface)
 	if err != nil {
 		log.Error().Msgf("Error setting up network: %v\n", err)
 		return
 	}
 
-	var mu sync.Mutex
-	discoveredDevices := make(map[string]*model.Device)
+	// A user supplied OUI file refreshes the embedded vendor table, e.g. with a newer IEEE download.
+	if ouiFile := viper.GetString("oui_file"); ouiFile != "" {
+		if err := oui.LoadFile(ouiFile); err != nil {
+			log.Error().Msgf("Error loading OUI file '%s': %v", ouiFile, err)
+		}
+	}
+
+	if scanWatch {
+		if scanAgainstBaseline {
+			log.Error().Msg("--against-baseline cannot be used with --watch")
+			os.Exit(1)
+		}
+		runWatch(cmd, target)
+		return
+	}
 
-	// Goroutine to display a spinner while scanning.
+	var baseline []model.BaselineEntry
+	if scanAgainstBaseline {
+		if baseline, err = store.Baseline().List(); err != nil {
+			log.Error().Msgf("Failed to read the baseline: %v", err)
+			os.Exit(1)
+		}
+		if len(baseline) == 0 {
+			log.Error().Msg("The baseline is empty, run 'idiot baseline save' or 'idiot baseline add' first.")
+			os.Exit(1)
+		}
+	}
+
+	start := time.Now()
+	stopSpinner := startSpinner(cmd)
+	discoveredDevices, phaseErrors := discoverDevices(target, loadScanSettings())
+	stopSpinner()
+
+	reconcileSavedDevices(discoveredDevices)
+	saveScanHistory(target, start, discoveredDevices)
+	unknown := markUnknownDevices(discoveredDevices, baseline)
+	for _, device := range output.SortDevices(discoveredDevices) {
+		fireHook(hooks.DeviceFound, *device)
+	}
+
+	if outputFormat != "" {
+		if err := output.WriteDevices(cmd.OutOrStdout(), outputFormat, discoveredDevices); err != nil {
+			log.Error().Msgf("Error writing scan output: %v", err)
+		}
+		if scanAgainstBaseline {
+			exitIfNotBaseline(unknown, phaseErrors)
+		}
+		return
+	}
+
+	cmd.Println("\nSelect an IOT device to save for later use:")
+	selectedIotDevice, _ := ui.CreateInteractiveSelect(discoveredDevices)
+	if selectedIotDevice != nil {
+		saved := *selectedIotDevice
+		saved.Unknown = false
+		added, err := store.Devices().Add(saved)
+		if err != nil {
+			log.Error().Msgf("Failed to save the device: %v", err)
+		} else if added {
+			fireHook(hooks.DeviceSaved, saved)
+			log.Debug().Msgf("Successfully added '%s' to 'selected_devices' in the configuration file.", selectedIotDevice.AddrV4)
+		} else {
+			log.Debug().Msgf("Device '%s' is already in the list. No changes made.", selectedIotDevice.AddrV4)
+		}
+	} else {
+		log.Debug().Msg("No device selected. Configuration not updated.")
+	}
+	if scanAgainstBaseline {
+		exitIfNotBaseline(unknown, phaseErrors)
+	}
+}
+
+// markUnknownDevices marks every discovered device that matches no entry of the baseline as unknown,
+// and returns them. Nothing is marked when the baseline is empty.
+func markUnknownDevices(discoveredDevices map[string]*model.Device, baseline []model.BaselineEntry) []*model.Device {
+	if len(baseline) == 0 {
+		return nil
+	}
+	var unknown []*model.Device
+	for _, device := range output.SortDevices(discoveredDevices) {
+		if !model.InBaseline(baseline, device) {
+			device.Unknown = true
+			unknown = append(unknown, device)
+		}
+	}
+	return unknown
+}
+
+// exitIfNotBaseline exits with 1, once running hooks have finished, if any devices are not in the baseline
+// or any discovery phase failed, as the devices only that phase would have found cannot have been checked.
+func exitIfNotBaseline(unknown []*model.Device, phaseErrors map[string]error) {
+	if len(unknown) == 0 && len(phaseErrors) == 0 {
+		return
+	}
+	if len(unknown) > 0 {
+		names := make([]string, 0, len(unknown))
+		for _, device := range unknown {
+			names = append(names, device.AddrV4)
+		}
+		log.Error().Msgf("Found %d devices not in the baseline: %s", len(unknown), strings.Join(names, ", "))
+	}
+	if len(phaseErrors) > 0 {
+		phases := slices.Sorted(maps.Keys(phaseErrors))
+		for _, phase := range phases {
+			log.Error().Msgf("The %s discovery phase failed: %v", phase, phaseErrors[phase])
+		}
+		log.Error().Msgf("The scan is incomplete, devices not in the baseline may have been missed. Failed phases: %s", strings.Join(phases, ", "))
+	}
+	loadHooks().Wait()
+	os.Exit(1)
+}
+
+// startSpinner shows a spinner while scanning, until the returned function is called.
+func startSpinner(cmd *cobra.Command) (stop func()) {
 	done := make(chan bool)
+	stopped := make(chan bool)
 	go func() {
+		defer close(stopped)
 		spinner := []string{"-", "\\", "|", "/"}
 		i := 0
 		for {
@@ -55,26 +215,77 @@ func runScan(cmd *cobra.Command, args []string) {
 			}
 		}
 	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
 
+// The discovery phases of a scan that can fail, as named in the errors returned by discoverDevices.
+const (
+	phaseMdns = "mdns"
+	phaseIcmp = "icmp"
+	phaseArp  = "arp"
+	phaseSsdp = "ssdp"
+)
+
+// discoveryPhases lists every discovery phase.
+var discoveryPhases = []string{phaseMdns, phaseIcmp, phaseArp, phaseSsdp}
+
+// scanSettings are the settings of a scan that come from the configuration file. They are read
+// before scanning starts, so that a scan running in the background never reads the configuration
+// while something else writes it, such as a change to the saved devices through the serve API.
+type scanSettings struct {
+	ports       network.PortScanOptions
+	grabBanners bool
+}
+
+// loadScanSettings reads the scan settings from the configuration file and the --ports flag.
+func loadScanSettings() scanSettings {
+	return scanSettings{ports: portScanOptions(), grabBanners: viper.GetBool("grab_banners")}
+}
+
+// discoverDevices runs the discovery and enrichment phases of a scan over the target, returning
+// every device found keyed by IPv4 address. Each device is given its stable ID. The discovery
+// phases that failed are returned with their errors, keyed by phase; the scan carries on without them.
+func discoverDevices(target *network.ScanTarget, settings scanSettings) (map[string]*model.Device, map[string]error) {
+	var mu sync.Mutex
+	discoveredDevices := make(map[string]*model.Device)
+	phaseErrors := make(map[string]error)
 	var wg sync.WaitGroup
 
 	// Phase 1: Discover devices on the network.
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		network.PerformMdnsScan(iface, discoveredDevices, &mu)
-	}()
-	go func() {
-		defer wg.Done()
-		network.PerformIcmpScan(networkAddr, broadcastAddr, discoveredDevices, &mu)
-	}()
+	phases := map[string]func() error{
+		phaseMdns: func() error { return network.PerformMdnsScan(target, discoveredDevices, &mu) },
+		phaseIcmp: func() error { return network.PerformIcmpScan(target.IPs, discoveredDevices, &mu) },
+		phaseArp:  func() error { return network.PerformArpScan(target.Interface, target.IPs, discoveredDevices, &mu) },
+		phaseSsdp: func() error { return network.PerformSsdpScan(target, discoveredDevices, &mu) },
+	}
+	for phase, discover := range phases {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := discover(); err != nil {
+				mu.Lock()
+				phaseErrors[phase] = err
+				mu.Unlock()
+			}
+		}()
+	}
 	wg.Wait()
 
+	// Label devices by manufacturer now that every discovery source has had a chance to find a MAC address.
+	oui.LabelDevices(discoveredDevices)
+
 	// Phase 2: Enrich the discovered device data.
 	wg.Add(2)
 	go func() {
 		defer wg.Done()
-		network.PerformSSHScan(discoveredDevices)
+		network.PerformPortScan(discoveredDevices, &mu, settings.ports)
+		if settings.grabBanners {
+			network.PerformBannerGrab(discoveredDevices, &mu, settings.ports)
+		}
+		network.PerformHostKeyScan(discoveredDevices, &mu, settings.ports)
 	}()
 	go func() {
 		defer wg.Done()
@@ -82,13 +293,67 @@ func runScan(cmd *cobra.Command, args []string) {
 	}()
 	wg.Wait()
 
-	close(done) // Stop the spinner.
+	// Give every device an ID that survives a change of address.
+	for _, device := range discoveredDevices {
+		device.ID = device.StableID()
+	}
+	return discoveredDevices, phaseErrors
+}
 
-	cmd.Println("\nSelect an IOT device to save for later use:")
-	selectedIotDevice, _ := ui.CreateInteractiveSelect(discoveredDevices)
-	if selectedIotDevice != nil {
-		internal.SaveSelectedIotDevice(selectedIotDevice)
-	} else {
-		log.Debug().Msg("No device selected. Configuration not updated.")
+// reconcileSavedDevices updates the saved devices with the addresses they were found at, logging each one that moved.
+func reconcileSavedDevices(discoveredDevices map[string]*model.Device) {
+	changes, err := store.Devices().Reconcile(discoveredDevices)
+	if err != nil {
+		log.Error().Msgf("Failed to update saved devices: %v", err)
+		return
+	}
+	for _, change := range changes {
+		log.Info().Msgf("Saved device %s moved from %s to %s.", change.Device.Name(), change.OldAddrV4, change.Device.AddrV4)
+	}
+}
+
+// saveScanHistory adds the scan to the history, keeping at most history_limit scans. A limit of 0 turns the history off.
+func saveScanHistory(target *network.ScanTarget, start time.Time, discoveredDevices map[string]*model.Device) {
+	limit := viper.GetInt("history_limit")
+	if limit <= 0 {
+		return
+	}
+	scans, err := history.DefaultStore()
+	if err != nil {
+		log.Error().Msgf("Failed to save scan history: %v", err)
+		return
+	}
+
+	scan := &history.Scan{
+		Time:       start,
+		Addresses:  len(target.IPs),
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if target.Interface != nil {
+		scan.Interface = target.Interface.Name
+	}
+	for _, device := range output.SortDevices(discoveredDevices) {
+		scan.Devices = append(scan.Devices, *device)
+	}
+	if err := scans.Save(scan, limit); err != nil {
+		log.Error().Msgf("Failed to save scan history: %v", err)
+		return
+	}
+	log.Debug().Msgf("Saved scan %s to %s.", scan.ID, scans.Dir())
+}
+
+// portScanOptions builds the port scan settings from the configuration file and the --ports flag.
+func portScanOptions() network.PortScanOptions {
+	opts := network.PortScanOptions{
+		Ports:       scanPorts,
+		Concurrency: viper.GetInt("port_scan_concurrency"),
+		Timeout:     viper.GetDuration("port_scan_timeout"),
+	}
+	if len(opts.Ports) == 0 {
+		opts.Ports = viper.GetIntSlice("scan_ports")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 1 * time.Second
 	}
+	return opts
 }
@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"com.bradleytenuta/idiot/internal/api"
+	"com.bradleytenuta/idiot/internal/hooks"
+	"com.bradleytenuta/idiot/internal/metrics"
+	"com.bradleytenuta/idiot/internal/model"
+	"com.bradleytenuta/idiot/internal/network"
+	"com.bradleytenuta/idiot/internal/oui"
+	"com.bradleytenuta/idiot/internal/output"
+	"com.bradleytenuta/idiot/internal/store"
+)
+
+var (
+	// serveMetrics is the address the Prometheus metrics are served on, e.g. ":9100".
+	serveMetrics string
+	// serveListen is the address the HTTP API is served on, e.g. ":8080".
+	serveListen string
+	// serveInsecureNoAuth allows the API to be served on a non-loopback address without the api_token setting.
+	serveInsecureNoAuth bool
+	// serveInterval is the time between the start of each scan. When 0, scans only run when requested through the API.
+	serveInterval time.Duration
+	// serveCIDRs, serveRanges and serveInterface select what to scan, as with the scan command.
+	serveCIDRs     []string
+	serveRanges    []string
+	serveInterface string
+)
+
+// init registers the serve command with the root command.
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringVar(&serveMetrics, "metrics", "", "address to serve Prometheus metrics on at /metrics, e.g. :9100")
+	serveCmd.Flags().StringVar(&serveListen, "listen", "", "address to serve the HTTP API on at /api, e.g. :8080")
+	serveCmd.Flags().BoolVar(&serveInsecureNoAuth, "insecure-no-auth", false, "serve the API on a non-loopback address without the api_token setting")
+	serveCmd.Flags().DurationVar(&serveInterval, "interval", 5*time.Minute, "time between the start of each scan, 0 to only scan when requested through the API")
+	serveCmd.Flags().StringSliceVar(&serveCIDRs, "cidr", nil, "IPv4 CIDR to scan, e.g. 192.168.1.0/24 (repeatable)")
+	serveCmd.Flags().StringSliceVar(&serveRanges, "range", nil, "inclusive IPv4 range to scan, e.g. 192.168.1.10-50 (repeatable)")
+	serveCmd.Flags().StringVarP(&serveInterface, "interface", "i", "", "network interface to scan from, e.g. eth1")
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Scan the network on a schedule and serve the results.",
+	Long: `Scan the network when started and then every --interval until interrupted, serving the results of the latest scan.
+With --metrics, Prometheus metrics are served at /metrics: the devices that are up, their ICMP round trip time and
+SSH port, the devices found by each discovery source, the scan duration and a count of the discovery phases that failed.
+With --listen, an HTTP API is served at /api to list the devices found, trigger a scan, and manage the saved devices.
+Requests that change anything need the api_token setting as a bearer token. Without it, the API is only served
+on a loopback address, unless --insecure-no-auth is given.
+Saved devices found at a new address are updated after every scan, but scans are not added to the scan history.`,
+	Example: "  idiot serve --metrics :9100\n  idiot serve --listen 127.0.0.1:8080 --interval 0\n  idiot serve --listen 127.0.0.1:8080 --metrics :9100 --interval 1m --cidr 10.20.0.0/24",
+	Args:    cobra.NoArgs,
+	Run:     runServe,
+}
+
+// runServe serves the metrics endpoint and the HTTP API, and scans the network on a schedule until interrupted.
+func runServe(cmd *cobra.Command, args []string) {
+	if serveMetrics == "" && serveListen == "" {
+		log.Error().Msg("Nothing to serve, use --metrics or --listen.")
+		os.Exit(1)
+	}
+	if serveInterval < 0 || (serveInterval == 0 && serveListen == "") {
+		log.Error().Msgf("Invalid interval %s, it must be more than 0, or 0 with --listen", serveInterval)
+		os.Exit(1)
+	}
+	token := viper.GetString("api_token")
+	if serveListen != "" && token == "" && !isLoopbackAddr(serveListen) && !serveInsecureNoAuth {
+		log.Error().Msgf("The api_token setting is empty, so anyone who can reach %s could change the saved devices. "+
+			"Set api_token, listen on a loopback address such as 127.0.0.1:8080, or use --insecure-no-auth.", serveListen)
+		os.Exit(1)
+	}
+	target, err := network.ResolveScanTarget(serveCIDRs, serveRanges, serveInterface)
+	if err != nil {
+		log.Error().Msgf("Error setting up network: %v", err)
+		os.Exit(1)
+	}
+	if ouiFile := viper.GetString("oui_file"); ouiFile != "" {
+		if err := oui.LoadFile(ouiFile); err != nil {
+			log.Error().Msgf("Error loading OUI file '%s': %v", ouiFile, err)
+		}
+	}
+
+	// The settings and hooks are read now, as the API may write the configuration file while a scan is running.
+	scheduler := newScanScheduler(target, serveInterval, loadScanSettings())
+	loadHooks()
+	// The metrics and the API share a server when they are given the same address.
+	muxes := make(map[string]*http.ServeMux)
+	muxFor := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+	if serveMetrics != "" {
+		scheduler.exporter = metrics.NewExporter(discoveryPhases)
+		muxFor(serveMetrics).Handle("GET /metrics", scheduler.exporter)
+	}
+	if serveListen != "" {
+		if token == "" {
+			log.Info().Msg("The api_token setting is empty, so anyone who can reach the API can change the saved devices.")
+		}
+		server := api.NewServer(scheduler, store.Devices(), token)
+		server.OnSaved = func(device model.Device) { fireHook(hooks.DeviceSaved, device) }
+		server.Register(muxFor(serveListen))
+	}
+
+	var servers []*http.Server
+	for addr, mux := range muxes {
+		// Listen before scanning, so that an address that is in use fails straight away.
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Error().Msgf("Failed to listen on %s: %v", addr, err)
+			os.Exit(1)
+		}
+		server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		servers = append(servers, server)
+		go func() {
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error().Msgf("Server on %s failed: %v", addr, err)
+			}
+		}()
+	}
+	if serveMetrics != "" {
+		log.Info().Msgf("Serving metrics on http://%s/metrics", serveMetrics)
+	}
+	if serveListen != "" {
+		log.Info().Msgf("Serving the API on http://%s/api", serveListen)
+	}
+	if serveInterval > 0 {
+		log.Info().Msgf("Scanning every %s. Press Ctrl+C to stop.", serveInterval)
+	} else {
+		log.Info().Msg("Scanning when requested through the API. Press Ctrl+C to stop.")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for _, server := range servers {
+			server.Shutdown(shutdownCtx)
+		}
+	}()
+	scheduler.run(ctx)
+}
+
+// isLoopbackAddr reports whether a listen address such as "127.0.0.1:8080" or "localhost:8080" only
+// accepts connections from this host. An address without a host, such as ":8080", listens on every interface.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// scanScheduler scans the target when started, then every interval and whenever a scan is triggered,
+// keeping the result of the latest scan. It is the api.Scanner of the serve command.
+type scanScheduler struct {
+	target   *network.ScanTarget
+	settings scanSettings
+	interval time.Duration
+	// exporter records the metrics of every scan, when metrics are served.
+	exporter *metrics.Exporter
+	// trigger holds a request for a scan until the scheduler is ready for it. Requests made while one
+	// is already waiting are merged into it.
+	trigger chan struct{}
+
+	mu      sync.Mutex
+	latest  metrics.Scan
+	scans   int
+	running bool
+}
+
+// newScanScheduler returns a scheduler for the target. An interval of 0 only scans when triggered, after the first scan.
+func newScanScheduler(target *network.ScanTarget, interval time.Duration, settings scanSettings) *scanScheduler {
+	return &scanScheduler{target: target, settings: settings, interval: interval, trigger: make(chan struct{}, 1)}
+}
+
+// run scans until the context is cancelled.
+func (s *scanScheduler) run(ctx context.Context) {
+	for {
+		start := time.Now()
+		s.mu.Lock()
+		s.running = true
+		s.mu.Unlock()
+
+		// Scanning cannot be cancelled part way, so an interrupt stops waiting for it instead.
+		scanned := make(chan metrics.Scan, 1)
+		go func() { scanned <- scanOnce(s.target, s.settings, start) }()
+		select {
+		case <-ctx.Done():
+			return
+		case scan := <-scanned:
+			s.record(scan)
+			log.Debug().Msgf("Scan found %d devices in %s.", len(scan.Devices), scan.Duration.Round(time.Millisecond))
+		}
+
+		// Wait until the next scan is due, starting it straight away if this scan took longer than the interval.
+		var next <-chan time.Time
+		if s.interval > 0 {
+			next = time.After(time.Until(start.Add(s.interval)))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-next:
+		case <-s.trigger:
+		}
+	}
+}
+
+// record keeps the result of a scan, and records its metrics.
+func (s *scanScheduler) record(scan metrics.Scan) {
+	s.mu.Lock()
+	s.latest = scan
+	s.scans++
+	s.running = false
+	s.mu.Unlock()
+	if s.exporter != nil {
+		s.exporter.Record(scan)
+	}
+}
+
+// Devices returns the devices found by the latest scan.
+func (s *scanScheduler) Devices() []model.Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest.Devices
+}
+
+// Status returns the state of the scans.
+func (s *scanScheduler) Status() api.ScanStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := api.ScanStatus{Running: s.running, Scans: s.scans}
+	if s.scans > 0 {
+		lastScan := s.latest.Time
+		status.LastScan = &lastScan
+		status.DurationMs = s.latest.Duration.Milliseconds()
+		status.Devices = len(s.latest.Devices)
+	}
+	return status
+}
+
+// Trigger requests a scan, which starts when the scan in progress, if any, has finished.
+func (s *scanScheduler) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// scanOnce scans the target, updates the saved devices found at a new address, and returns the result for the exporter.
+func scanOnce(target *network.ScanTarget, settings scanSettings, start time.Time) metrics.Scan {
+	discoveredDevices, phaseErrors := discoverDevices(target, settings)
+	reconcileSavedDevices(discoveredDevices)
+
+	scan := metrics.Scan{Time: start, Duration: time.Since(start)}
+	for _, device := range output.SortDevices(discoveredDevices) {
+		scan.Devices = append(scan.Devices, *device)
+	}
+	for phase := range phaseErrors {
+		scan.FailedPhases = append(scan.FailedPhases, phase)
+	}
+	slices.Sort(scan.FailedPhases)
+	saved, err := store.Devices().List()
+	if err != nil {
+		log.Error().Msgf("Failed to read saved devices: %v", err)
+	}
+	scan.Saved = saved
+	return scan
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"com.bradleytenuta/idiot/internal"
+	"com.bradleytenuta/idiot/internal/api"
+	"com.bradleytenuta/idiot/internal/network"
+	"com.bradleytenuta/idiot/internal/store"
+)
+
+// useTestConfig points the configuration at a new file in a temporary directory, with no saved devices.
+func useTestConfig(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "configuration.yaml")
+	if err := os.WriteFile(path, []byte("selected_devices: []\n"), 0o644); err != nil {
+		t.Fatalf("failed to write configuration: %v", err)
+	}
+	viper.SetConfigFile(path)
+	viper.SetConfigType("yaml")
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("failed to read configuration: %v", err)
+	}
+	if err := internal.SetConfigDefaults(); err != nil {
+		t.Fatalf("failed to set configuration defaults: %v", err)
+	}
+}
+
+// TestServeSavedDevicesDuringScan verifies that the saved devices can be changed through the API while a
+// scan is running, without either of them touching the configuration unsafely. Run it with -race.
+func TestServeSavedDevicesDuringScan(t *testing.T) {
+	useTestConfig(t)
+	scheduler := newScanScheduler(&network.ScanTarget{}, 0, loadScanSettings())
+	mux := http.NewServeMux()
+	api.NewServer(scheduler, store.Devices(), "").Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		scheduler.run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	// Add and remove devices until the first scan has finished.
+	deadline := time.Now().Add(30 * time.Second)
+	for i := 0; scheduler.Status().Scans == 0; i++ {
+		if time.Now().After(deadline) {
+			t.Fatal("the scan did not finish")
+		}
+		addr := fmt.Sprintf("192.168.1.%d", i%250+1)
+		response, err := server.Client().Post(server.URL+"/api/saved-devices", "application/json",
+			strings.NewReader(`{"addrV4": "`+addr+`", "hostname": "device-`+addr+`"}`))
+		if err != nil {
+			t.Fatalf("POST failed with %v", err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusCreated {
+			t.Fatalf("POST of %s = %d, want 201", addr, response.StatusCode)
+		}
+		request, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/saved-devices/"+addr, nil)
+		if response, err = server.Client().Do(request); err != nil {
+			t.Fatalf("DELETE failed with %v", err)
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusNoContent {
+			t.Fatalf("DELETE of %s = %d, want 204", addr, response.StatusCode)
+		}
+	}
+}
+
+// TestIsLoopbackAddr verifies which listen addresses only accept connections from this host.
+func TestIsLoopbackAddr(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1:8080": true,
+		"localhost:8080": true,
+		"[::1]:8080":     true,
+		":8080":          false,
+		"0.0.0.0:8080":   false,
+		"10.20.0.5:8080": false,
+		"myhost:8080":    false,
+		"127.0.0.1":      false,
+	}
+	for addr, want := range tests {
+		if got := isLoopbackAddr(addr); got != want {
+			t.Errorf("isLoopbackAddr(%q) = %v, want %v", addr, got, want)
+		}
+	}
+}
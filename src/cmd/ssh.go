@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
@@ -12,9 +16,10 @@ import (
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/term"
 
-	"com.bradleytenuta/idiot/internal"
+	"com.bradleytenuta/idiot/internal/hooks"
 	"com.bradleytenuta/idiot/internal/model"
 	"com.bradleytenuta/idiot/internal/network"
+	"com.bradleytenuta/idiot/internal/store"
 	"com.bradleytenuta/idiot/internal/ui"
 )
 
@@ -37,24 +42,14 @@ func runSsh(cmd *cobra.Command, args []string) {
 	// We are calling a function that returns another function, and then deferring the execution of the returned function.
 	// This uses the function returned by initTerminal  schedules it to be executed right before the surrounding function exits.
 	defer ui.InitTerminal()()
-	savedDevices := internal.ReadIotDevices()
 	cmd.Println("Select an IOT device to SSH into:")
-	addr, user, password, err := getLoginDetails(savedDevices)
+	device, err := chooseDevice("")
 	if err != nil {
 		return
 	}
-	client, err := getClient(addr, user, password)
+	client, err := connectDevice(device)
 	if err != nil {
 		log.Error().Msgf("Failed to create client: %v", err)
-		if strings.Contains(err.Error(), "knownhosts: key is unknown") {
-			host, _, splitErr := net.SplitHostPort(addr)
-			if splitErr != nil {
-				host = addr // Fallback to the original address if splitting fails for some reason.
-			}
-			log.Info().Msgf("Host key for %s is not trusted. To trust this host, add its key to your ~/.ssh/known_hosts file."+
-				" You can do this on Linux/macOS by running: ssh-keyscan -H 192.168.86.21 >> ~/.ssh/known_hosts", host)
-		}
-
 		return
 	}
 	defer client.Close()
@@ -64,43 +59,238 @@ func runSsh(cmd *cobra.Command, args []string) {
 		return
 	}
 	defer session.Close()
+	fireHook(hooks.SSHSessionStarted, *device)
+	defer fireSessionEnded(*device, time.Now())
 	handleInteractiveSession(session)
 }
 
-// getLoginDetails prompts the user to select a device from the saved list
-// and then prompts for a username and password. It returns the selected
-// device's address, the entered credentials, or an error.
-func getLoginDetails(savedDevices []model.Device) (string, string, string, error) {
-	selectedDevice, err := ui.CreateInteractiveSelect(model.ListToMap(savedDevices))
+// chooseDevice returns the saved device matching ref, by IPv4 address, alias, hostname, MAC address
+// or ~/.ssh/config Host alias, or asks the user to select one of the saved devices when ref is empty.
+func chooseDevice(ref string) (*model.Device, error) {
+	savedDevices, err := store.Devices().List()
 	if err != nil {
-		return "", "", "", err
+		return nil, err
+	}
+	if ref == "" {
+		return ui.CreateInteractiveSelect(model.ListToMap(savedDevices))
+	}
+	device := model.FindDevice(savedDevices, ref)
+	if device == nil {
+		// The name may be a Host alias from ~/.ssh/config for the address of a saved device.
+		if hostName := loadSSHConfig().Lookup([]string{ref}, "").HostName; hostName != "" {
+			device = model.FindDevice(savedDevices, hostName)
+		}
+	}
+	if device == nil {
+		return nil, fmt.Errorf("no saved device matches '%s'", ref)
+	}
+	return device, nil
+}
+
+// deviceLoginDetails returns the address, username and identity files used to log in to a
+// device, prompting for the username if none is saved for the device. The device's identity
+// file is used when it has one, otherwise every IdentityFile from ~/.ssh/config is tried in turn.
+func deviceLoginDetails(selectedDevice *model.Device, settings network.SSHHostConfig) (string, string, []string, error) {
+	var err error
+	user := selectedDevice.User
+	if user == "" {
+		user, err = ui.GetPromptInput("Username", 0)
+		if err != nil {
+			log.Error().Msgf("Failed to get username: %v", err)
+			return "", "", nil, err
+		}
 	}
 
-	user, err := ui.GetPromptInput("Username", 0)
+	addr, err := network.AddPort(selectedDevice.AddrV4, selectedDevice.SSHPort)
 	if err != nil {
-		log.Error().Msgf("Failed to get username: %v", err)
-		return "", "", "", err
+		log.Error().Msgf("Invalid address: %v", err)
+		return "", "", nil, err
 	}
+	identityFiles := settings.IdentityFiles
+	if selectedDevice.IdentityFile != "" {
+		identityFiles = []string{selectedDevice.IdentityFile}
+	}
+	return addr, user, identityFiles, nil
+}
 
-	password, err := ui.GetPromptInput("Password", '*')
+// connectDevice logs in to a device, going through each of its jump hosts in turn. Every hop
+// is authenticated and has its host key verified separately. The jump host connections are
+// closed when the returned client is closed. Settings missing from a device are taken from
+// ~/.ssh/config.
+func connectDevice(device *model.Device) (*ssh.Client, error) {
+	device, settings := withSSHConfig(device)
+	chain, err := jumpChain(device, nil)
 	if err != nil {
-		log.Error().Msgf("Failed to get password: %v", err)
-		return "", "", "", err
+		return nil, err
+	}
+
+	var hops []*ssh.Client
+	closeHops := func() {
+		for i := len(hops) - 1; i >= 0; i-- {
+			_ = hops[i].Close()
+		}
+	}
+	// via is the connection the next hop is dialled through, or nil to dial it directly.
+	var via *ssh.Client
+
+	for _, hop := range chain {
+		addr, user, identityFiles, err := deviceLoginDetails(hop.device, hop.settings)
+		if err != nil {
+			closeHops()
+			return nil, err
+		}
+		log.Debug().Msgf("Connecting to jump host %s.", addr)
+		via, err = getClient(addr, user, identityFiles, via)
+		if err != nil {
+			closeHops()
+			return nil, fmt.Errorf("failed to connect to jump host '%s': %w", hop.ref, err)
+		}
+		hops = append(hops, via)
+		keepAlive(via, hop.settings)
 	}
 
-	addr, err := network.AddPort(selectedDevice.AddrV4)
+	addr, user, identityFiles, err := deviceLoginDetails(device, settings)
 	if err != nil {
-		log.Error().Msgf("Invalid address: %v", err)
-		return "", "", "", err
+		closeHops()
+		return nil, err
+	}
+	client, err := getClient(addr, user, identityFiles, via)
+	if err != nil {
+		closeHops()
+		return nil, err
+	}
+	keepAlive(client, settings)
+	if len(hops) > 0 {
+		go func() {
+			_ = client.Wait()
+			closeHops()
+		}()
+	}
+	return client, nil
+}
+
+// jumpHop is a jump host to connect through, with the ~/.ssh/config settings that apply to it.
+type jumpHop struct {
+	ref      string
+	device   *model.Device
+	settings network.SSHHostConfig
+}
+
+// jumpChain returns the jump hosts to connect through to reach the device, in the order they are
+// connected. As with OpenSSH, the first jump host is reached through its own jump hosts, and each
+// later one is reached through the jump host before it. seen holds the jump hosts already in the
+// chain, so a jump host that leads back to itself is reported rather than followed forever.
+func jumpChain(device *model.Device, seen map[string]bool) ([]jumpHop, error) {
+	if seen == nil {
+		seen = make(map[string]bool)
+	}
+	var chain []jumpHop
+	for i, ref := range device.JumpHosts {
+		jumpHost, err := resolveJumpHost(ref)
+		if err != nil {
+			return nil, err
+		}
+		jumpHost, jumpSettings := withSSHConfig(jumpHost)
+		key := jumpHost.User + "@" + net.JoinHostPort(jumpHost.AddrV4, strconv.Itoa(jumpHost.SSHPort))
+		if seen[key] {
+			return nil, fmt.Errorf("jump host '%s' leads back to itself", ref)
+		}
+		seen[key] = true
+
+		if i == 0 {
+			before, err := jumpChain(jumpHost, seen)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, before...)
+		}
+		chain = append(chain, jumpHop{ref: ref, device: jumpHost, settings: jumpSettings})
+	}
+	return chain, nil
+}
+
+// loadSSHConfig returns the user's ~/.ssh/config, which is read the first time it is needed.
+var loadSSHConfig = sync.OnceValue(func() *network.SSHConfig {
+	config, err := network.LoadSSHConfig()
+	if err != nil {
+		log.Error().Msgf("Failed to read ~/.ssh/config, ignoring it: %v", err)
+		return &network.SSHConfig{}
+	}
+	return config
+})
+
+// withSSHConfig returns a copy of the device with the username, port and jump hosts it does
+// not have taken from ~/.ssh/config, matched by its hostname or IP address, along with the
+// settings that applied, which include the identity files. A jump host given by a name rather than an address, such as
+// a Host alias, is also given the address from its HostName.
+func withSSHConfig(device *model.Device) (*model.Device, network.SSHHostConfig) {
+	names := []string{device.AddrV4}
+	if hostname := strings.TrimSuffix(device.Hostname, "."); hostname != "" {
+		names = []string{hostname, device.AddrV4}
+	}
+	if device.Alias != "" {
+		names = append(names, device.Alias)
+	}
+	settings := loadSSHConfig().Lookup(names, device.User)
+
+	configured := *device
+	if configured.User == "" {
+		configured.User = settings.User
+	}
+	if configured.SSHPort == 0 {
+		configured.SSHPort = settings.Port
+	}
+	if len(configured.JumpHosts) == 0 {
+		configured.JumpHosts = settings.ProxyJump
+	}
+	if settings.HostName != "" && net.ParseIP(configured.AddrV4) == nil {
+		configured.AddrV4 = settings.HostName
+	}
+	return &configured, settings
+}
+
+// keepAlive sends keepalives on the connection if ServerAliveInterval is set for the host in ~/.ssh/config.
+func keepAlive(client *ssh.Client, settings network.SSHHostConfig) {
+	if settings.ServerAliveInterval <= 0 {
+		return
+	}
+	countMax := settings.ServerAliveCountMax
+	if countMax <= 0 {
+		// The OpenSSH default for ServerAliveCountMax.
+		countMax = 3
+	}
+	go network.KeepAlive(client, settings.ServerAliveInterval, countMax)
+}
+
+// resolveJumpHost returns the saved device a jump host refers to, by IPv4 address, alias, hostname
+// or MAC address. Otherwise the jump host is read as a "[user@]host[:port]" address.
+func resolveJumpHost(ref string) (*model.Device, error) {
+	device, err := store.Devices().Get(ref)
+	if err == nil {
+		return &device, nil
+	} else if !errors.Is(err, store.ErrDeviceNotFound) {
+		return nil, err
 	}
-	return addr, user, password, nil
+	user, host, port, err := network.ParseUserHost(ref)
+	if err != nil {
+		return nil, fmt.Errorf("invalid jump host: %w", err)
+	}
+	return &model.Device{AddrV4: host, User: user, SSHPort: port}, nil
 }
 
-// getClient establishes an SSH connection to the given address using the
-// provided user and password. It uses a host key callback for security,
-// which can be overridden to an insecure mode via configuration.
-func getClient(addr string, user string, password string) (*ssh.Client, error) {
-	hostKeyCallback, err := network.GetHostKeyCallback()
+// getClient establishes an SSH connection to the given address as the given user.
+// Authentication methods are tried in the order of the ssh_auth_methods setting,
+// using the identity files if any are given. It uses a host key callback for security,
+// which asks the user to trust hosts that are not in known_hosts yet, and
+// can be overridden to an insecure mode via configuration.
+// The connection is made through the via client when one is given, such as a jump host.
+func getClient(addr string, user string, identityFiles []string, via *ssh.Client) (*ssh.Client, error) {
+	authMethods, err := network.GetAuthMethods(viper.GetStringSlice("ssh_auth_methods"), identityFiles, ui.GetPromptInput)
+	if err != nil {
+		return nil, err
+	}
+
+	hostKeyCallback, err := network.GetHostKeyCallback(confirmHostKey)
 	if err != nil {
 		return nil, fmt.Errorf("could not create host key callback from known_hosts: %v", err)
 	} else if !viper.GetBool("ssh_secure_mode") {
@@ -109,17 +299,39 @@ func getClient(addr string, user string, password string) (*ssh.Client, error) {
 	}
 
 	config := &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{
-			ssh.Password(password),
-		},
+		User:            user,
+		Auth:            authMethods,
 		HostKeyCallback: hostKeyCallback,
+		// Prefer the key types already in known_hosts, so a host with several keys is not reported as changed.
+		HostKeyAlgorithms: network.GetKnownHostKeyAlgorithms(addr),
+	}
+	if via == nil {
+		return ssh.Dial("tcp", addr, config)
+	}
+
+	conn, err := via.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
 	}
-	client, err := ssh.Dial("tcp", addr, config)
+	clientConn, channels, requests, err := ssh.NewClientConn(conn, addr, config)
 	if err != nil {
+		_ = conn.Close()
 		return nil, err
 	}
-	return client, nil
+	return ssh.NewClient(clientConn, channels, requests), nil
+}
+
+// hostKeyPromptMu keeps each host's fingerprint next to its question when several connections are made at once.
+var hostKeyPromptMu sync.Mutex
+
+// confirmHostKey shows the fingerprint of a host key that is not in known_hosts and asks the user
+// whether to trust it, in the same way as OpenSSH does on the first connection to a host.
+func confirmHostKey(hostname, keyType, fingerprint string) (bool, error) {
+	hostKeyPromptMu.Lock()
+	defer hostKeyPromptMu.Unlock()
+
+	fmt.Fprintf(os.Stderr, "The authenticity of host '%s' can't be established.\n%s key fingerprint is %s.\n", hostname, keyType, fingerprint)
+	return ui.Confirm("Are you sure you want to continue connecting")
 }
 
 // handleInteractiveSession sets up and manages an interactive SSH session.
@@ -164,6 +376,15 @@ func handleInteractiveSession(session *ssh.Session) {
 		return
 	}
 
+	// Keep the remote PTY the same size as the local terminal, so full screen programs such as vim,
+	// htop and tmux redraw correctly when the window is resized.
+	stopWatching := ui.WatchTerminalSize(outFd, func(width, height int) {
+		if err := session.WindowChange(height, width); err != nil {
+			log.Debug().Msgf("Failed to send window change: %v", err)
+		}
+	})
+	defer stopWatching()
+
 	// Connects the session's standard input, output, and error streams to the SSH session.
 	session.Stdin = os.Stdin
 	session.Stdout = os.Stdout
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"com.bradleytenuta/idiot/internal/model"
+	"com.bradleytenuta/idiot/internal/network"
+)
+
+// useSSHConfig replaces ~/.ssh/config with the given text for the rest of the test.
+func useSSHConfig(t *testing.T, text string) {
+	t.Helper()
+	config, err := network.ParseSSHConfig(strings.NewReader(text), t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to parse ssh config: %v", err)
+	}
+	saved := loadSSHConfig
+	loadSSHConfig = func() *network.SSHConfig { return config }
+	t.Cleanup(func() { loadSSHConfig = saved })
+}
+
+// TestJumpChain verifies that a jump host's own ProxyJump is followed, as OpenSSH does for chained
+// bastions, and that a jump host leading back to itself is reported.
+func TestJumpChain(t *testing.T) {
+	useTestConfig(t)
+	useSSHConfig(t, `
+Host inner
+    HostName 10.0.0.2
+    ProxyJump outer
+Host outer
+    HostName 203.0.113.1
+    User admin
+Host second
+    HostName 10.0.0.3
+    ProxyJump outer
+Host loop-a
+    HostName 10.0.1.1
+    ProxyJump loop-b
+Host loop-b
+    HostName 10.0.1.2
+    ProxyJump loop-a
+`)
+
+	device, _ := withSSHConfig(&model.Device{AddrV4: "10.0.0.10", JumpHosts: []string{"inner", "second"}})
+	chain, err := jumpChain(device, nil)
+	if err != nil {
+		t.Fatalf("jumpChain() failed with %v", err)
+	}
+	var got []string
+	for _, hop := range chain {
+		got = append(got, hop.ref+"="+hop.device.AddrV4)
+	}
+	// Only the first jump host's own ProxyJump is followed; "second" is reached through "inner".
+	want := "outer=203.0.113.1 inner=10.0.0.2 second=10.0.0.3"
+	if strings.Join(got, " ") != want {
+		t.Errorf("unexpected jump chain.\ngot:  %s\nwant: %s", strings.Join(got, " "), want)
+	}
+	if chain[0].device.User != "admin" {
+		t.Errorf("the outer jump host did not get its user from the ssh config, got %q", chain[0].device.User)
+	}
+
+	if _, err := jumpChain(&model.Device{AddrV4: "10.0.0.10", JumpHosts: []string{"loop-a"}}, nil); err == nil {
+		t.Error("a jump host loop was not reported")
+	}
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/pkg/sftp"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"com.bradleytenuta/idiot/internal/transfer"
+	"com.bradleytenuta/idiot/internal/ui"
+)
+
+var (
+	// transferDevice selects the saved device to copy to or from. When empty, the user is asked to select one.
+	transferDevice string
+	// transferRecursive and transferResume hold the --recursive and --resume flags.
+	transferRecursive bool
+	transferResume    bool
+)
+
+// init registers the push and pull commands with the root command.
+func init() {
+	for _, command := range []*cobra.Command{pushCmd, pullCmd} {
+		rootCmd.AddCommand(command)
+		command.Flags().StringVarP(&transferDevice, "device", "d", "", "saved device to copy with, by IPv4 address, alias, hostname or MAC address, instead of selecting one")
+		command.Flags().BoolVarP(&transferRecursive, "recursive", "r", false, "copy directories and everything in them")
+		command.Flags().BoolVar(&transferResume, "resume", false, "continue partially copied files rather than starting them again")
+	}
+}
+
+var pushCmd = &cobra.Command{
+	Use:   "push <local>... <remote>",
+	Short: "Copy files to a saved IOT device.",
+	Long: `Copy local files or directories to one of the saved IOT devices over SFTP. If the remote path is an
+existing directory, the files are copied into it. Permission bits are preserved.`,
+	Example: "  idiot push firmware.bin '~/updates/'\n  idiot push -r config/ /etc/myapp",
+	Args:    cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runTransfer(cmd, args, true)
+	},
+}
+
+var pullCmd = &cobra.Command{
+	Use:   "pull <remote>... <local>",
+	Short: "Copy files from a saved IOT device.",
+	Long: `Copy files or directories from one of the saved IOT devices over SFTP. Remote paths can be glob patterns,
+which are expanded on the device. If the local path is an existing directory, the files are copied into it.
+Permission bits are preserved.`,
+	Example: "  idiot pull '/var/log/*.log' ./logs\n  idiot pull -r --resume '~/recordings' .",
+	Args:    cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		runTransfer(cmd, args, false)
+	},
+}
+
+// runTransfer connects to the chosen device over SFTP and copies the files, pushing them to the
+// device or pulling them from it. The last argument is the target and the rest are the sources.
+// It exits with 1 if any file could not be copied.
+func runTransfer(cmd *cobra.Command, args []string, push bool) {
+	defer ui.InitTerminal()()
+	if err := transferFiles(cmd, args[:len(args)-1], args[len(args)-1], push); err != nil {
+		log.Error().Msgf("Failed to copy files: %v", err)
+		os.Exit(1)
+	}
+}
+
+// transferFiles opens an SFTP session with the device and copies the sources to the target.
+func transferFiles(cmd *cobra.Command, sources []string, target string, push bool) error {
+	device, err := chooseDevice(transferDevice)
+	if err != nil {
+		return err
+	}
+	client, err := connectDevice(device)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return err
+	}
+	defer sftpClient.Close()
+
+	opts := transfer.Options{Recursive: transferRecursive, Resume: transferResume}
+	// Progress lines are redrawn in place, which only makes sense on a terminal.
+	if term.IsTerminal(int(os.Stderr.Fd())) {
+		opts.Progress = cmd.ErrOrStderr()
+	}
+
+	if push {
+		return transfer.Copy(transfer.Local(), sources, transfer.Remote(sftpClient), target, opts)
+	}
+	return transfer.Copy(transfer.Remote(sftpClient), sources, transfer.Local(), target, opts)
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"com.bradleytenuta/idiot/internal/hooks"
+	"com.bradleytenuta/idiot/internal/model"
+	"com.bradleytenuta/idiot/internal/network"
+	"com.bradleytenuta/idiot/internal/output"
+	"com.bradleytenuta/idiot/internal/watch"
+)
+
+// runWatch scans the target every scanInterval until interrupted, printing an event whenever a device joins,
+// leaves or changes address. Events are printed one per line, or as JSON lines with --output json. Saved devices
+// found at a new address are updated after every round, but rounds are not added to the scan history.
+func runWatch(cmd *cobra.Command, target *network.ScanTarget) {
+	if outputFormat != "" && outputFormat != "json" {
+		log.Error().Msgf("Invalid output format '%s' for --watch, expected: json", outputFormat)
+		os.Exit(1)
+	}
+	if scanInterval <= 0 {
+		log.Error().Msgf("Invalid interval %s, it must be more than 0", scanInterval)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	settings := loadScanSettings()
+	tracker := watch.NewTracker(scanMissedRounds)
+	encoder := json.NewEncoder(cmd.OutOrStdout())
+	for round := 1; ; round++ {
+		start := time.Now()
+		// Scanning cannot be cancelled part way, so an interrupt stops waiting for it instead.
+		scanned := make(chan map[string]*model.Device, 1)
+		go func() {
+			discoveredDevices, _ := discoverDevices(target, settings)
+			scanned <- discoveredDevices
+		}()
+		var discoveredDevices map[string]*model.Device
+		select {
+		case <-ctx.Done():
+			return
+		case discoveredDevices = <-scanned:
+		}
+		reconcileSavedDevices(discoveredDevices)
+
+		var found []model.Device
+		for _, device := range output.SortDevices(discoveredDevices) {
+			found = append(found, *device)
+		}
+		events := tracker.Update(found, start)
+		if round == 1 {
+			for _, device := range found {
+				fireHook(hooks.DeviceFound, device)
+			}
+			log.Info().Msgf("Found %d devices, watching for changes every %s. Press Ctrl+C to stop.", len(found), scanInterval)
+		}
+		for _, event := range events {
+			if event.Kind == watch.Joined {
+				fireHook(hooks.DeviceFound, event.Device)
+			}
+			if outputFormat == "json" {
+				if err := encoder.Encode(event); err != nil {
+					log.Error().Msgf("Failed to write event: %v", err)
+				}
+				continue
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s %s\n", event.Time.Local().Format(time.DateTime), event)
+		}
+		log.Debug().Msgf("Watch round %d found %d devices in %s.", round, len(found), time.Since(start).Round(time.Millisecond))
+
+		// Wait until the next round is due, starting it straight away if this round took longer than the interval.
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(start.Add(scanInterval))):
+		}
+	}
+}
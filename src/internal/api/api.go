@@ -0,0 +1,245 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"com.bradleytenuta/idiot/internal/model"
+	"com.bradleytenuta/idiot/internal/store"
+)
+
+// maxBodyBytes limits the size of a request body.
+const maxBodyBytes = 1 << 20
+
+// ScanStatus describes the scans run by the server.
+type ScanStatus struct {
+	// Running is true while a scan is in progress.
+	Running bool `json:"running"`
+	// Scans is the number of scans completed since the server started.
+	Scans int `json:"scans"`
+	// LastScan is when the latest completed scan started, and DurationMs how long it took.
+	LastScan   *time.Time `json:"lastScan,omitempty"`
+	DurationMs int64      `json:"durationMs"`
+	// Devices is the number of devices found by the latest scan.
+	Devices int `json:"devices"`
+}
+
+// Scanner runs the scans whose results are served.
+type Scanner interface {
+	// Devices returns the devices found by the latest scan, sorted by IPv4 address.
+	Devices() []model.Device
+	// Status returns the state of the scans.
+	Status() ScanStatus
+	// Trigger starts a scan as soon as possible, without waiting for it to finish.
+	Trigger()
+}
+
+// Server serves the devices found by the scanner and the saved devices as JSON, using the model.Device
+// schema. When a token is set, requests that change anything must send it as a bearer token.
+type Server struct {
+	scanner Scanner
+	devices *store.DeviceStore
+	token   string
+	// OnSaved, when set, is called with every device saved through the API, e.g. to fire hooks.
+	OnSaved func(device model.Device)
+}
+
+// NewServer returns a server for the scanner's results and the saved devices in the store. An empty token turns authentication off.
+func NewServer(scanner Scanner, devices *store.DeviceStore, token string) *Server {
+	return &Server{scanner: scanner, devices: devices, token: token}
+}
+
+// Register adds the API's endpoints to mux, under /api.
+func (s *Server) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/devices", s.listDevices)
+	mux.HandleFunc("GET /api/devices/{ref}", s.getDevice)
+	mux.HandleFunc("GET /api/scan", s.scanStatus)
+	mux.HandleFunc("POST /api/scan", s.authorize(s.triggerScan))
+	mux.HandleFunc("GET /api/saved-devices", s.listSaved)
+	mux.HandleFunc("GET /api/saved-devices/{ref}", s.getSaved)
+	mux.HandleFunc("POST /api/saved-devices", s.authorize(s.addSaved))
+	mux.HandleFunc("PUT /api/saved-devices/{ref}", s.authorize(s.updateSaved))
+	mux.HandleFunc("DELETE /api/saved-devices/{ref}", s.authorize(s.removeSaved))
+}
+
+// authorize wraps a handler so that it is only called when the request has the server's bearer token, if it has one.
+func (s *Server) authorize(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="idiot"`)
+				writeError(w, http.StatusUnauthorized, errors.New("a valid bearer token is required"))
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// listDevices responds with the devices found by the latest scan.
+func (s *Server) listDevices(w http.ResponseWriter, r *http.Request) {
+	devices := s.scanner.Devices()
+	if devices == nil {
+		devices = []model.Device{}
+	}
+	writeJSON(w, http.StatusOK, devices)
+}
+
+// getDevice responds with the device found by the latest scan with the ID, IPv4 address, hostname or MAC address in the path.
+func (s *Server) getDevice(w http.ResponseWriter, r *http.Request) {
+	ref := r.PathValue("ref")
+	devices := s.scanner.Devices()
+	for _, device := range devices {
+		if device.ID != "" && device.ID == ref {
+			writeJSON(w, http.StatusOK, device)
+			return
+		}
+	}
+	if device := model.FindDevice(devices, ref); device != nil {
+		writeJSON(w, http.StatusOK, device)
+		return
+	}
+	writeError(w, http.StatusNotFound, errors.New("no device found by the latest scan matches '"+ref+"'"))
+}
+
+// scanStatus responds with the state of the scans.
+func (s *Server) scanStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.scanner.Status())
+}
+
+// triggerScan starts a scan and responds straight away with the state of the scans.
+func (s *Server) triggerScan(w http.ResponseWriter, r *http.Request) {
+	s.scanner.Trigger()
+	status := s.scanner.Status()
+	status.Running = true
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+// listSaved responds with the saved devices.
+func (s *Server) listSaved(w http.ResponseWriter, r *http.Request) {
+	devices, err := s.devices.List()
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if devices == nil {
+		devices = []model.Device{}
+	}
+	writeJSON(w, http.StatusOK, devices)
+}
+
+// getSaved responds with the saved device matching the IPv4 address, alias, hostname or MAC address in the path.
+func (s *Server) getSaved(w http.ResponseWriter, r *http.Request) {
+	device, err := s.devices.Get(r.PathValue("ref"))
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, device)
+}
+
+// addSaved saves the device in the request body. It responds with 409 if the device is already saved.
+func (s *Server) addSaved(w http.ResponseWriter, r *http.Request) {
+	device, ok := readDevice(w, r)
+	if !ok {
+		return
+	}
+	if device.ID == "" {
+		device.ID = device.StableID()
+	}
+	added, err := s.devices.Add(device)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !added {
+		writeError(w, http.StatusConflict, errors.New("the device "+device.AddrV4+" is already saved"))
+		return
+	}
+	if s.OnSaved != nil {
+		s.OnSaved(device)
+	}
+	writeJSON(w, http.StatusCreated, device)
+}
+
+// updateSaved replaces the saved device matching the path with the device in the request body. The
+// device keeps its ID if the body does not have one.
+func (s *Server) updateSaved(w http.ResponseWriter, r *http.Request) {
+	replacement, ok := readDevice(w, r)
+	if !ok {
+		return
+	}
+	device, err := s.devices.Update(r.PathValue("ref"), func(device *model.Device) error {
+		if replacement.ID == "" {
+			replacement.ID = device.ID
+		}
+		*device = replacement
+		return nil
+	})
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, device)
+}
+
+// removeSaved deletes the saved device matching the path.
+func (s *Server) removeSaved(w http.ResponseWriter, r *http.Request) {
+	if _, err := s.devices.Remove(r.PathValue("ref")); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readDevice decodes the device in the request body, responding with 400 if it is not valid JSON or has no valid IPv4 address.
+func readDevice(w http.ResponseWriter, r *http.Request) (model.Device, bool) {
+	var device model.Device
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(&device); err != nil {
+		writeError(w, http.StatusBadRequest, errors.New("invalid device: "+err.Error()))
+		return model.Device{}, false
+	}
+	if addr, err := netip.ParseAddr(device.AddrV4); err != nil || !addr.Is4() {
+		writeError(w, http.StatusBadRequest, errors.New("invalid device: addrV4 must be an IPv4 address"))
+		return model.Device{}, false
+	}
+	device.Unknown = false
+	return device, true
+}
+
+// writeStoreError responds with the status matching an error from the device store.
+func writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrDeviceNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, store.ErrInvalidAlias):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		log.Error().Msgf("API request failed: %v", err)
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// writeError responds with the error as a JSON object, e.g. {"error": "no saved device matches 'garage-pi'"}.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// writeJSON responds with the value as indented JSON.
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		log.Debug().Msgf("Failed to write API response: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"com.bradleytenuta/idiot/internal/model"
+	"com.bradleytenuta/idiot/internal/store"
+)
+
+// fakeScanner serves fixed devices and counts the scans triggered.
+type fakeScanner struct {
+	devices   []model.Device
+	triggered int
+}
+
+func (f *fakeScanner) Devices() []model.Device { return f.devices }
+func (f *fakeScanner) Status() ScanStatus      { return ScanStatus{Scans: 1, Devices: len(f.devices)} }
+func (f *fakeScanner) Trigger()                { f.triggered++ }
+
+// newTestServer returns a test HTTP server for the API, with the token "secret" and saved devices in a temporary
+// configuration file. Devices saved through the API are sent to onSaved, if it is not nil.
+func newTestServer(t *testing.T, scanner Scanner, onSaved func(model.Device)) *httptest.Server {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "configuration.yaml")
+	if err := os.WriteFile(path, []byte("selected_devices: []\n"), 0o644); err != nil {
+		t.Fatalf("failed to write configuration: %v", err)
+	}
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatalf("failed to read configuration: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	apiServer := NewServer(scanner, store.NewDeviceStore(v), "secret")
+	apiServer.OnSaved = onSaved
+	apiServer.Register(mux)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// do sends a request to the server, with the token when authorized is true, and decodes the JSON response into out if it is not nil.
+func do(t *testing.T, server *httptest.Server, method, path, body string, authorized bool, out any) int {
+	t.Helper()
+	request, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if authorized {
+		request.Header.Set("Authorization", "Bearer secret")
+	}
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatalf("%s %s failed with %v", method, path, err)
+	}
+	defer response.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+			t.Fatalf("failed to decode the response to %s %s: %v", method, path, err)
+		}
+	}
+	return response.StatusCode
+}
+
+// TestDevices verifies that the devices found by the latest scan can be listed and fetched, and that scans can be triggered.
+func TestDevices(t *testing.T) {
+	scanner := &fakeScanner{devices: []model.Device{
+		{ID: "mac:b8:27:eb:12:34:56", AddrV4: "192.168.1.20", MAC: "b8:27:eb:12:34:56", Hostname: "raspberrypi"},
+		{AddrV4: "192.168.1.30", Hostname: "printer"},
+	}}
+	server := newTestServer(t, scanner, nil)
+
+	var devices []model.Device
+	if status := do(t, server, "GET", "/api/devices", "", false, &devices); status != http.StatusOK || len(devices) != 2 {
+		t.Errorf("GET /api/devices = %d, %+v", status, devices)
+	}
+	for _, ref := range []string{"mac:b8:27:eb:12:34:56", "B8:27:EB:12:34:56", "raspberrypi", "192.168.1.20"} {
+		var device model.Device
+		if status := do(t, server, "GET", "/api/devices/"+ref, "", false, &device); status != http.StatusOK || device.AddrV4 != "192.168.1.20" {
+			t.Errorf("GET /api/devices/%s = %d, %+v", ref, status, device)
+		}
+	}
+	if status := do(t, server, "GET", "/api/devices/192.168.1.99", "", false, nil); status != http.StatusNotFound {
+		t.Errorf("GET of a missing device = %d, want 404", status)
+	}
+
+	if status := do(t, server, "POST", "/api/scan", "", false, nil); status != http.StatusUnauthorized || scanner.triggered != 0 {
+		t.Errorf("POST /api/scan without a token = %d, triggered %d times", status, scanner.triggered)
+	}
+	var scanStatus ScanStatus
+	if status := do(t, server, "POST", "/api/scan", "", true, &scanStatus); status != http.StatusAccepted || scanner.triggered != 1 || !scanStatus.Running {
+		t.Errorf("POST /api/scan = %d, %+v, triggered %d times", status, scanStatus, scanner.triggered)
+	}
+}
+
+// TestSavedDevices verifies that saved devices can be created, read, updated and deleted, and that changes need the token.
+func TestSavedDevices(t *testing.T) {
+	var saved []model.Device
+	server := newTestServer(t, &fakeScanner{}, func(device model.Device) { saved = append(saved, device) })
+	pi := `{"addrV4": "192.168.1.20", "mac": "b8:27:eb:12:34:56", "hostname": "raspberrypi", "canConnectSSH": true, "sources": ["ARP"]}`
+
+	if status := do(t, server, "POST", "/api/saved-devices", pi, false, nil); status != http.StatusUnauthorized {
+		t.Errorf("POST without a token = %d, want 401", status)
+	}
+	var created model.Device
+	if status := do(t, server, "POST", "/api/saved-devices", pi, true, &created); status != http.StatusCreated || created.ID != "mac:b8:27:eb:12:34:56" {
+		t.Errorf("POST = %d, %+v", status, created)
+	}
+	if status := do(t, server, "POST", "/api/saved-devices", pi, true, nil); status != http.StatusConflict {
+		t.Errorf("POST of a saved device = %d, want 409", status)
+	}
+	if status := do(t, server, "POST", "/api/saved-devices", `{"hostname": "printer"}`, true, nil); status != http.StatusBadRequest {
+		t.Errorf("POST without an address = %d, want 400", status)
+	}
+	if len(saved) != 1 || saved[0].ID != "mac:b8:27:eb:12:34:56" {
+		t.Errorf("expected one device saved callback for the Pi, got %+v", saved)
+	}
+
+	updated := `{"addrV4": "192.168.1.42", "mac": "b8:27:eb:12:34:56", "alias": "garage-pi", "user": "pi", "sources": ["ARP"]}`
+	var device model.Device
+	if status := do(t, server, "PUT", "/api/saved-devices/raspberrypi", updated, true, &device); status != http.StatusOK ||
+		device.Alias != "garage-pi" || device.ID != "mac:b8:27:eb:12:34:56" {
+		t.Errorf("PUT = %d, %+v", status, device)
+	}
+	if status := do(t, server, "PUT", "/api/saved-devices/garage-pi", `{"addrV4": "192.168.1.42", "alias": "garage pi"}`, true, nil); status != http.StatusBadRequest {
+		t.Errorf("PUT with an invalid alias = %d, want 400", status)
+	}
+	if status := do(t, server, "GET", "/api/saved-devices/garage-pi", "", false, &device); status != http.StatusOK || device.User != "pi" {
+		t.Errorf("GET = %d, %+v", status, device)
+	}
+
+	if status := do(t, server, "DELETE", "/api/saved-devices/garage-pi", "", true, nil); status != http.StatusNoContent {
+		t.Errorf("DELETE = %d, want 204", status)
+	}
+	if status := do(t, server, "DELETE", "/api/saved-devices/garage-pi", "", true, nil); status != http.StatusNotFound {
+		t.Errorf("DELETE of a missing device = %d, want 404", status)
+	}
+	var devices []model.Device
+	if status := do(t, server, "GET", "/api/saved-devices", "", false, &devices); status != http.StatusOK || len(devices) != 0 {
+		t.Errorf("GET /api/saved-devices = %d, %+v", status, devices)
+	}
+}
@@ -3,7 +3,6 @@ package internal
 import (
 	"os"
 
-	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
 	"gopkg.in/yaml.v3"
 
@@ -35,49 +34,21 @@ func WriteConfigFile(configFilePath string) error {
 	return os.WriteFile(configFilePath, yamlBytes, 0o644)
 }
 
-// ReadIotDevices retrieves the list of saved IoT devices from the configuration.
-// It uses viper to unmarshal the 'selected_devices' key into a slice of Device structs.
-func ReadIotDevices() []model.Device {
-	var iotDevices []model.Device
-	if err := viper.UnmarshalKey("selected_devices", &iotDevices); err != nil {
-		log.Error().Msgf("Error reading IOT Devices from the configuration file: %v", err)
-		return []model.Device{}
-	}
-	return iotDevices
-}
-
-// SaveSelectedIotDevice adds a new device to the 'selected_devices' list in the
-// configuration file. It prevents duplicate entries based on the device's IPv4 address.
-func SaveSelectedIotDevice(iotDevice *model.Device) {
-	// Retrieve the current list of devices from the configuration.
-	var configDevices []model.Device
-	if err := viper.UnmarshalKey("selected_devices", &configDevices); err != nil {
-		log.Error().Msgf("Failed to read 'selected_devices' from config: %v", err)
-		return
+// SetConfigDefaults registers the default value of every setting with viper, so that
+// configuration files written by older versions still get sensible values for newer settings.
+func SetConfigDefaults() error {
+	yamlBytes, err := yaml.Marshal(model.NewConfig())
+	if err != nil {
+		return err
 	}
-
-	// Check for duplicates using the string representation of the IP address.
-	isDuplicate := false
-	for _, cd := range configDevices {
-		if cd.AddrV4 == iotDevice.AddrV4 {
-			isDuplicate = true
-			break
-		}
+	var defaults map[string]interface{}
+	if err := yaml.Unmarshal(yamlBytes, &defaults); err != nil {
+		return err
 	}
-
-	if isDuplicate {
-		log.Debug().Msgf("Device '%s' is already in the list. No changes made.", iotDevice.AddrV4)
-	} else {
-		// Append the new, serializable device to the list.
-		configDevices = append(configDevices, *iotDevice)
-
-		// Set the updated slice back into viper.
-		viper.Set("selected_devices", configDevices)
-
-		// Write the changes to the configuration file.
-		if err := viper.WriteConfig(); err != nil {
-			log.Error().Msgf("Error writing configuration file: %v", err)
+	for key, value := range defaults {
+		if key != "selected_devices" {
+			viper.SetDefault(key, value)
 		}
-		log.Debug().Msgf("Successfully added '%s' to 'selected_devices' in the configuration file.", iotDevice.AddrV4)
 	}
+	return nil
 }
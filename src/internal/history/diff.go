@@ -0,0 +1,121 @@
+package history
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// The kinds of difference between two scans.
+const (
+	Appeared    = "appeared"
+	Disappeared = "disappeared"
+	Changed     = "changed"
+)
+
+// DeviceDiff is a device that differs between two scans. Device is the device as found by the newer
+// scan, or by the older scan when it disappeared.
+type DeviceDiff struct {
+	Kind    string        `json:"kind"`
+	Device  model.Device  `json:"device"`
+	Changes []FieldChange `json:"changes,omitempty"`
+}
+
+// FieldChange is a field of a device that has a different value in the newer scan.
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// String describes the change, e.g. "addrV4 192.168.1.20 -> 192.168.1.42".
+func (c FieldChange) String() string {
+	return fmt.Sprintf("%s %s -> %s", c.Field, orNone(c.Old), orNone(c.New))
+}
+
+// Diff compares two scans, returning the devices that appeared in the newer scan, disappeared from
+// it, or changed IPv4 address, hostname, open ports or services. Devices are matched by stable ID or
+// identity key, so a device given a new address by DHCP shows as changed rather than as one device
+// disappearing and another appearing. Devices without an identity are matched by IPv4 address.
+// Appeared and changed devices are in the order of the newer scan, followed by those that disappeared.
+func Diff(older, newer Scan) []DeviceDiff {
+	var diffs []DeviceDiff
+	matched := make([]bool, len(older.Devices))
+	for i := range newer.Devices {
+		device := &newer.Devices[i]
+		previous := model.FindSameDevice(older.Devices, device)
+		// An older device is only matched once, so a second device sharing its identity, such as a
+		// copy of the same SSH host key, is reported as having appeared.
+		j := -1
+		for k := range older.Devices {
+			if &older.Devices[k] == previous {
+				j = k
+			}
+		}
+		if previous == nil || matched[j] {
+			diffs = append(diffs, DeviceDiff{Kind: Appeared, Device: *device})
+			continue
+		}
+		matched[j] = true
+		if changes := compareDevices(previous, device); len(changes) > 0 {
+			diffs = append(diffs, DeviceDiff{Kind: Changed, Device: *device, Changes: changes})
+		}
+	}
+	for i, device := range older.Devices {
+		if !matched[i] {
+			diffs = append(diffs, DeviceDiff{Kind: Disappeared, Device: device})
+		}
+	}
+	return diffs
+}
+
+// compareDevices returns the fields that differ between two scans of the same device.
+func compareDevices(older, newer *model.Device) []FieldChange {
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"addrV4", older.AddrV4, newer.AddrV4},
+		{"hostname", older.Hostname, newer.Hostname},
+		{"openPorts", joinPorts(older.OpenPorts), joinPorts(newer.OpenPorts)},
+		{"services", joinServices(older.Services), joinServices(newer.Services)},
+	}
+	var changes []FieldChange
+	for _, field := range fields {
+		if field.old != field.new {
+			changes = append(changes, FieldChange{Field: field.name, Old: field.old, New: field.new})
+		}
+	}
+	return changes
+}
+
+// joinPorts returns the ports in ascending order, joined by ','.
+func joinPorts(ports []int) string {
+	sorted := slices.Sorted(slices.Values(ports))
+	formatted := make([]string, 0, len(sorted))
+	for _, port := range sorted {
+		formatted = append(formatted, strconv.Itoa(port))
+	}
+	return strings.Join(formatted, ",")
+}
+
+// joinServices returns each service as "<type>:<port>", sorted and joined by ','.
+func joinServices(services []model.Service) string {
+	formatted := make([]string, 0, len(services))
+	for _, service := range services {
+		formatted = append(formatted, service.Type+":"+strconv.Itoa(service.Port))
+	}
+	slices.Sort(formatted)
+	return strings.Join(slices.Compact(formatted), ",")
+}
+
+// orNone returns the value, or "none" when it is empty.
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
@@ -0,0 +1,173 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// idLayout formats the time of a scan into its ID, which is also its file name. IDs sort in the
+// order the scans were made.
+const idLayout = "20060102T150405.000Z"
+
+// ErrScanNotFound is returned when no saved scan matches the given reference.
+var ErrScanNotFound = errors.New("no saved scan matches")
+
+// Scan is the result of a single run of the scan command.
+type Scan struct {
+	ID         string         `json:"id"`
+	Time       time.Time      `json:"time"`
+	Interface  string         `json:"interface,omitempty"`
+	Addresses  int            `json:"addresses"`
+	DurationMs int64          `json:"durationMs"`
+	Devices    []model.Device `json:"devices"`
+}
+
+// Store keeps every scan as a JSON file in a directory, so that scans can be listed and compared later.
+type Store struct {
+	dir string
+}
+
+// NewStore returns a store that keeps scans in dir. The directory is created when the first scan is saved.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// DefaultStore returns the store in the user's configuration directory, e.g. ~/.config/idiot/history on Linux.
+func DefaultStore() (*Store, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the user configuration directory: %w", err)
+	}
+	return NewStore(filepath.Join(configDir, "idiot", "history")), nil
+}
+
+// Dir returns the directory the scans are kept in.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Save writes the scan to the store, giving it an ID from its time. Scans beyond the newest keep
+// are then deleted, unless keep is 0.
+func (s *Store) Save(scan *Scan, keep int) error {
+	if scan.Time.IsZero() {
+		scan.Time = time.Now()
+	}
+	scan.Time = scan.Time.UTC()
+	scan.ID = scan.Time.Format(idLayout)
+	if scan.Devices == nil {
+		scan.Devices = []model.Device{}
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	data, err := json.Marshal(scan)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so an interrupted write never leaves a truncated scan.
+	path := filepath.Join(s.dir, scan.ID+".json")
+	if err := os.WriteFile(path+".tmp", data, 0o644); err != nil {
+		return fmt.Errorf("failed to write scan: %w", err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write scan: %w", err)
+	}
+
+	if keep > 0 {
+		return s.prune(keep)
+	}
+	return nil
+}
+
+// IDs returns the IDs of the saved scans, oldest first.
+func (s *Store) IDs() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history directory: %w", err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		if id, found := strings.CutSuffix(entry.Name(), ".json"); found && !entry.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// List returns every saved scan, oldest first.
+func (s *Store) List() ([]Scan, error) {
+	ids, err := s.IDs()
+	if err != nil {
+		return nil, err
+	}
+	scans := make([]Scan, 0, len(ids))
+	for _, id := range ids {
+		scan, err := s.load(id)
+		if err != nil {
+			return nil, err
+		}
+		scans = append(scans, scan)
+	}
+	return scans, nil
+}
+
+// Get returns the scan matching ref, which is either a scan ID or its number in the list of saved
+// scans, counting from 1 for the oldest. "latest" is the most recent scan.
+func (s *Store) Get(ref string) (Scan, error) {
+	ids, err := s.IDs()
+	if err != nil {
+		return Scan{}, err
+	}
+	if ref == "latest" && len(ids) > 0 {
+		return s.load(ids[len(ids)-1])
+	}
+	if n, err := strconv.Atoi(ref); err == nil && n >= 1 && n <= len(ids) {
+		return s.load(ids[n-1])
+	}
+	if slices.Contains(ids, ref) {
+		return s.load(ref)
+	}
+	return Scan{}, fmt.Errorf("%w '%s'", ErrScanNotFound, ref)
+}
+
+// load reads the scan with the given ID.
+func (s *Store) load(id string) (Scan, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, id+".json"))
+	if err != nil {
+		return Scan{}, fmt.Errorf("failed to read scan %s: %w", id, err)
+	}
+	var scan Scan
+	if err := json.Unmarshal(data, &scan); err != nil {
+		return Scan{}, fmt.Errorf("failed to read scan %s: %w", id, err)
+	}
+	return scan, nil
+}
+
+// prune deletes the oldest scans, leaving the newest keep.
+func (s *Store) prune(keep int) error {
+	ids, err := s.IDs()
+	if err != nil {
+		return err
+	}
+	for len(ids) > keep {
+		if err := os.Remove(filepath.Join(s.dir, ids[0]+".json")); err != nil {
+			return fmt.Errorf("failed to delete old scan: %w", err)
+		}
+		ids = ids[1:]
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package history
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// TestStore verifies that scans are saved, listed oldest first, found by ID or number, and pruned.
+func TestStore(t *testing.T) {
+	store := NewStore(t.TempDir())
+	start := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+
+	for i := 0; i < 4; i++ {
+		scan := &Scan{
+			Time:    start.Add(time.Duration(i) * time.Hour),
+			Devices: []model.Device{{AddrV4: "192.168.1.20", OpenPorts: []int{22 + i}}},
+		}
+		if err := store.Save(scan, 3); err != nil {
+			t.Fatalf("Save() failed with %v", err)
+		}
+	}
+
+	scans, err := store.List()
+	if err != nil {
+		t.Fatalf("List() failed with %v", err)
+	}
+	if len(scans) != 3 {
+		t.Fatalf("expected the 3 newest scans to be kept, got %d", len(scans))
+	}
+	if scans[0].ID != "20261017T103000.000Z" || scans[0].Devices[0].OpenPorts[0] != 23 {
+		t.Errorf("unexpected oldest scan: %+v", scans[0])
+	}
+
+	for ref, want := range map[string]string{
+		"1":                    "20261017T103000.000Z",
+		"3":                    "20261017T123000.000Z",
+		"latest":               "20261017T123000.000Z",
+		"20261017T113000.000Z": "20261017T113000.000Z",
+	} {
+		scan, err := store.Get(ref)
+		if err != nil || scan.ID != want {
+			t.Errorf("Get(%q) = %s, %v, want %s", ref, scan.ID, err, want)
+		}
+	}
+	for _, ref := range []string{"0", "4", "20261017T093000.000Z"} {
+		if _, err := store.Get(ref); !errors.Is(err, ErrScanNotFound) {
+			t.Errorf("Get(%q) returned %v, want ErrScanNotFound", ref, err)
+		}
+	}
+}
+
+// TestStoreEmpty verifies that a store whose directory does not exist yet has no scans.
+func TestStoreEmpty(t *testing.T) {
+	store := NewStore(t.TempDir() + "/missing")
+	if scans, err := store.List(); err != nil || len(scans) != 0 {
+		t.Errorf("List() = %v, %v, want no scans", scans, err)
+	}
+	if _, err := store.Get("latest"); !errors.Is(err, ErrScanNotFound) {
+		t.Errorf("Get(latest) returned %v, want ErrScanNotFound", err)
+	}
+}
+
+// TestDiff verifies that devices are matched across scans by identity, reporting what appeared, disappeared and changed.
+func TestDiff(t *testing.T) {
+	older := Scan{Devices: []model.Device{
+		{AddrV4: "192.168.1.20", MAC: "b8:27:eb:12:34:56", Hostname: "raspberrypi", OpenPorts: []int{22}},
+		{AddrV4: "192.168.1.30", Hostname: "printer", OpenPorts: []int{80, 443}},
+		{AddrV4: "192.168.1.40", MAC: "aa:bb:cc:dd:ee:ff"},
+	}}
+	newer := Scan{Devices: []model.Device{
+		{AddrV4: "192.168.1.42", MAC: "B8:27:EB:12:34:56", Hostname: "raspberrypi", OpenPorts: []int{80, 22},
+			Services: []model.Service{{Instance: "pi", Type: "_ssh._tcp", Port: 22}}},
+		{AddrV4: "192.168.1.30", Hostname: "printer", OpenPorts: []int{443, 80}},
+		{AddrV4: "192.168.1.50", MAC: "11:22:33:44:55:66"},
+	}}
+
+	diffs := Diff(older, newer)
+	if len(diffs) != 3 {
+		t.Fatalf("Diff() returned %d differences, want 3: %+v", len(diffs), diffs)
+	}
+
+	changed := diffs[0]
+	if changed.Kind != Changed || changed.Device.AddrV4 != "192.168.1.42" {
+		t.Errorf("unexpected first difference: %+v", changed)
+	}
+	want := []string{"addrV4 192.168.1.20 -> 192.168.1.42", "openPorts 22 -> 22,80", "services none -> _ssh._tcp:22"}
+	if len(changed.Changes) != len(want) {
+		t.Fatalf("unexpected changes: %v", changed.Changes)
+	}
+	for i, change := range changed.Changes {
+		if change.String() != want[i] {
+			t.Errorf("change %d = %q, want %q", i, change, want[i])
+		}
+	}
+
+	if diffs[1].Kind != Appeared || diffs[1].Device.AddrV4 != "192.168.1.50" {
+		t.Errorf("unexpected second difference: %+v", diffs[1])
+	}
+	if diffs[2].Kind != Disappeared || diffs[2].Device.AddrV4 != "192.168.1.40" {
+		t.Errorf("unexpected third difference: %+v", diffs[2])
+	}
+}
+
+// TestDiffMatchesOnce verifies that an older device is matched by only one newer device, so that a
+// second device sharing its identity is reported as having appeared.
+func TestDiffMatchesOnce(t *testing.T) {
+	older := Scan{Devices: []model.Device{{AddrV4: "10.20.0.5", HostKey: "SHA256:cloned"}}}
+	newer := Scan{Devices: []model.Device{
+		{AddrV4: "10.20.0.5", HostKey: "SHA256:cloned"},
+		{AddrV4: "10.20.0.6", HostKey: "SHA256:cloned"},
+	}}
+
+	diffs := Diff(older, newer)
+	if len(diffs) != 1 || diffs[0].Kind != Appeared || diffs[0].Device.AddrV4 != "10.20.0.6" {
+		t.Errorf("Diff() = %+v, want only 10.20.0.6 to have appeared", diffs)
+	}
+}
@@ -0,0 +1,219 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// The events hooks can be fired for.
+const (
+	DeviceFound       = "device_found"
+	DeviceSaved       = "device_saved"
+	SSHSessionStarted = "ssh_session_started"
+	SSHSessionEnded   = "ssh_session_ended"
+)
+
+// Events lists every event hooks can be fired for.
+var Events = []string{DeviceFound, DeviceSaved, SSHSessionStarted, SSHSessionEnded}
+
+// defaultTimeout limits each attempt to run a hook when the hook does not set its own timeout.
+const defaultTimeout = 10 * time.Second
+
+// defaultConcurrency limits how many times each hook runs at once when the hook does not set its own limit.
+const defaultConcurrency = 4
+
+// retryDelay is the wait before the first retry. It doubles for every retry after that.
+var retryDelay = time.Second
+
+// Hook is an action taken when an event happens, configured under the hooks setting. It either POSTs
+// the event as JSON to URL, or runs Command with the event as JSON on its standard input.
+type Hook struct {
+	// Events lists the events the hook fires for. Every event is used when it is empty.
+	Events []string `mapstructure:"events"`
+	URL    string   `mapstructure:"url"`
+	// Headers are added to the request sent to URL, e.g. for authentication.
+	Headers map[string]string `mapstructure:"headers"`
+	// Command is the program to run and its arguments.
+	Command []string `mapstructure:"command"`
+	// Timeout limits each attempt, and Retries is how many more attempts are made after a failure.
+	Timeout time.Duration `mapstructure:"timeout"`
+	Retries int           `mapstructure:"retries"`
+	// Concurrency limits how many events the hook handles at once. Later events wait for a slot.
+	Concurrency int `mapstructure:"concurrency"`
+}
+
+// Validate returns an error if the hook does not have exactly one of a URL or a command, or names an unknown event.
+func (h Hook) Validate() error {
+	if (h.URL == "") == (len(h.Command) == 0) {
+		return errors.New("a hook needs either a url or a command")
+	}
+	for _, event := range h.Events {
+		if !slices.Contains(Events, event) {
+			return fmt.Errorf("unknown event '%s', expected one of: %s", event, strings.Join(Events, ", "))
+		}
+	}
+	if h.Retries < 0 {
+		return fmt.Errorf("invalid number of retries %d", h.Retries)
+	}
+	if h.Concurrency < 0 {
+		return fmt.Errorf("invalid concurrency %d", h.Concurrency)
+	}
+	return nil
+}
+
+// String names the hook in log messages by its URL or command.
+func (h Hook) String() string {
+	if h.URL != "" {
+		return h.URL
+	}
+	return strings.Join(h.Command, " ")
+}
+
+// Event is the payload sent to a hook.
+type Event struct {
+	Event  string       `json:"event"`
+	Time   time.Time    `json:"time"`
+	Device model.Device `json:"device"`
+	// DurationMs is how long the SSH session lasted, for ssh_session_ended.
+	DurationMs int64 `json:"durationMs,omitempty"`
+}
+
+// Dispatcher runs the configured hooks for each event in the background.
+type Dispatcher struct {
+	hooks []Hook
+	// slots holds a semaphore for each hook, bounding how many times it runs at once.
+	slots  []chan struct{}
+	client *http.Client
+	wg     sync.WaitGroup
+}
+
+// NewDispatcher returns a dispatcher for the hooks. Invalid hooks are logged and skipped.
+func NewDispatcher(hooks []Hook) *Dispatcher {
+	d := &Dispatcher{client: &http.Client{}}
+	for i, hook := range hooks {
+		if err := hook.Validate(); err != nil {
+			log.Error().Msgf("Ignoring hook %d: %v", i+1, err)
+			continue
+		}
+		concurrency := hook.Concurrency
+		if concurrency == 0 {
+			concurrency = defaultConcurrency
+		}
+		d.hooks = append(d.hooks, hook)
+		d.slots = append(d.slots, make(chan struct{}, concurrency))
+	}
+	return d
+}
+
+// Fire runs every hook for the event in the background. The time of the event is set if it is zero.
+// A hook already running as many times as its concurrency allows waits for one of them to finish.
+// Call Wait before exiting, so that running hooks are not cut short.
+func (d *Dispatcher) Fire(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Error().Msgf("Failed to encode %s event: %v", event.Event, err)
+		return
+	}
+	for i, hook := range d.hooks {
+		if len(hook.Events) > 0 && !slices.Contains(hook.Events, event.Event) {
+			continue
+		}
+		d.wg.Add(1)
+		go func(hook Hook, slots chan struct{}) {
+			defer d.wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			if err := d.run(hook, event.Event, payload); err != nil {
+				log.Error().Msgf("Hook %s failed for %s event: %v", hook, event.Event, err)
+			}
+		}(hook, d.slots[i])
+	}
+}
+
+// Wait blocks until every hook that has been fired has finished.
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// run runs the hook, retrying it after a failure with a delay that doubles each time.
+func (d *Dispatcher) run(hook Hook, event string, payload []byte) error {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	delay := retryDelay
+	var err error
+	for attempt := 0; attempt <= hook.Retries; attempt++ {
+		if attempt > 0 {
+			log.Debug().Msgf("Retrying hook %s for %s event in %s: %v", hook, event, delay, err)
+			time.Sleep(delay)
+			delay *= 2
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		if hook.URL != "" {
+			err = d.post(ctx, hook, payload)
+		} else {
+			err = runCommand(ctx, hook.Command, event, payload)
+		}
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// post sends the payload to the hook's URL, failing unless the response status is 2xx.
+func (d *Dispatcher) post(ctx context.Context, hook Hook, payload []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "idiot")
+	for name, value := range hook.Headers {
+		request.Header.Set(name, value)
+	}
+	response, err := d.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected response %s", response.Status)
+	}
+	return nil
+}
+
+// runCommand runs the command with the payload on its standard input, and the event name in the
+// IDIOT_EVENT environment variable. It fails if the command exits with a non-zero status.
+func runCommand(ctx context.Context, command []string, event string, payload []byte) error {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(), "IDIOT_EVENT="+event)
+	out, err := cmd.CombinedOutput()
+	if len(out) > 0 {
+		log.Debug().Msgf("Hook %s output: %s", strings.Join(command, " "), strings.TrimSpace(string(out)))
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("timed out: %w", ctx.Err())
+	}
+	return err
+}
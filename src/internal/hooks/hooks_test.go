@@ -0,0 +1,132 @@
+package hooks
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// TestHookValidate verifies that a hook needs exactly one of a URL or a command, and only known events.
+func TestHookValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		hook    Hook
+		wantErr bool
+	}{
+		{name: "url", hook: Hook{URL: "https://example.com/hook", Events: []string{DeviceFound}}},
+		{name: "command", hook: Hook{Command: []string{"notify-send"}}},
+		{name: "neither", hook: Hook{Events: []string{DeviceFound}}, wantErr: true},
+		{name: "both", hook: Hook{URL: "https://example.com/hook", Command: []string{"true"}}, wantErr: true},
+		{name: "unknown event", hook: Hook{URL: "https://example.com/hook", Events: []string{"device_lost"}}, wantErr: true},
+		{name: "negative retries", hook: Hook{URL: "https://example.com/hook", Retries: -1}, wantErr: true},
+		{name: "negative concurrency", hook: Hook{URL: "https://example.com/hook", Concurrency: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.hook.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestDispatcherURL verifies that events are POSTed as JSON to hooks subscribed to them, retrying after a failure.
+func TestDispatcherURL(t *testing.T) {
+	retryDelay = time.Millisecond
+	var attempts atomic.Int32
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			t.Errorf("failed to decode payload: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	dispatcher := NewDispatcher([]Hook{{
+		Events:  []string{DeviceSaved},
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+		Retries: 2,
+	}})
+	dispatcher.Fire(Event{Event: DeviceFound, Device: model.Device{AddrV4: "192.168.1.30"}})
+	dispatcher.Fire(Event{Event: DeviceSaved, Device: model.Device{AddrV4: "192.168.1.20", Hostname: "raspberrypi"}})
+	dispatcher.Wait()
+
+	if got := attempts.Load(); got != 2 {
+		t.Errorf("expected 2 attempts, got %d", got)
+	}
+	if received.Event != DeviceSaved || received.Device.Hostname != "raspberrypi" || received.Time.IsZero() {
+		t.Errorf("unexpected payload: %+v", received)
+	}
+}
+
+// TestDispatcherCommand verifies that a command hook is given the event on its standard input and in IDIOT_EVENT.
+func TestDispatcherCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	out := filepath.Join(t.TempDir(), "event.json")
+	dispatcher := NewDispatcher([]Hook{{
+		Command: []string{"sh", "-c", `[ "$IDIOT_EVENT" = ssh_session_ended ] && cat > "$0"`, out},
+	}})
+	dispatcher.Fire(Event{Event: SSHSessionEnded, Device: model.Device{AddrV4: "192.168.1.20"}, DurationMs: 1500})
+	dispatcher.Wait()
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("the command did not write the event: %v", err)
+	}
+	var received Event
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatalf("failed to decode payload: %v", err)
+	}
+	if received.Event != SSHSessionEnded || received.Device.AddrV4 != "192.168.1.20" || received.DurationMs != 1500 {
+		t.Errorf("unexpected payload: %+v", received)
+	}
+}
+
+// TestDispatcherConcurrency verifies that a hook handles no more events at once than its concurrency allows.
+func TestDispatcherConcurrency(t *testing.T) {
+	var running, peak, received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := running.Add(1)
+		for {
+			old := peak.Load()
+			if now <= old || peak.CompareAndSwap(old, now) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		running.Add(-1)
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	dispatcher := NewDispatcher([]Hook{{URL: server.URL, Concurrency: 2}})
+	for range 10 {
+		dispatcher.Fire(Event{Event: DeviceFound, Device: model.Device{AddrV4: "192.168.1.30"}})
+	}
+	dispatcher.Wait()
+
+	if got := received.Load(); got != 10 {
+		t.Errorf("expected 10 events, got %d", got)
+	}
+	if got := peak.Load(); got > 2 {
+		t.Errorf("expected at most 2 events at once, got %d", got)
+	}
+}
@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// Sources lists the discovery sources that are always exported, so that a source that found nothing reports 0.
+var Sources = []string{"ICMP", "ARP", "mDNS", "SSDP"}
+
+// Scan is the result of one round of scanning, as recorded by the exporter.
+type Scan struct {
+	Time     time.Time
+	Duration time.Duration
+	// Devices are the devices found by the scan.
+	Devices []model.Device
+	// Saved are the saved devices. Those the scan did not find are exported as down.
+	Saved []model.Device
+	// FailedPhases names the discovery phases that failed.
+	FailedPhases []string
+}
+
+// Exporter keeps the metrics of the latest scan, and serves them to Prometheus in its text exposition format.
+type Exporter struct {
+	mu          sync.Mutex
+	last        *Scan
+	scans       int
+	phaseErrors map[string]int
+}
+
+// NewExporter returns an exporter with an error counter for each of the phases, starting at 0.
+func NewExporter(phases []string) *Exporter {
+	e := &Exporter{phaseErrors: make(map[string]int)}
+	for _, phase := range phases {
+		e.phaseErrors[phase] = 0
+	}
+	return e
+}
+
+// Record replaces the metrics of the latest scan, and counts the scan and its failed phases.
+func (e *Exporter) Record(scan Scan) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.last = &scan
+	e.scans++
+	for _, phase := range scan.FailedPhases {
+		e.phaseErrors[phase]++
+	}
+}
+
+// ServeHTTP writes the metrics in response to a scrape.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := e.Write(w); err != nil {
+		log.Debug().Msgf("Failed to write metrics: %v", err)
+	}
+}
+
+// Write writes the metrics to w in the Prometheus text exposition format. Until the first scan has
+// been recorded, only the counters are written.
+func (e *Exporter) Write(w io.Writer) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := bufio.NewWriter(w)
+
+	writeHeader(out, "idiot_scans_total", "counter", "Number of scans completed.")
+	fmt.Fprintf(out, "idiot_scans_total %d\n", e.scans)
+	writeHeader(out, "idiot_phase_errors_total", "counter", "Number of scans in which a discovery phase failed.")
+	phases := make([]string, 0, len(e.phaseErrors))
+	for phase := range e.phaseErrors {
+		phases = append(phases, phase)
+	}
+	slices.Sort(phases)
+	for _, phase := range phases {
+		fmt.Fprintf(out, "idiot_phase_errors_total{phase=%s} %d\n", quote(phase), e.phaseErrors[phase])
+	}
+
+	if e.last != nil {
+		e.writeScan(out, e.last)
+	}
+	return out.Flush()
+}
+
+// writeScan writes the gauges describing the latest scan.
+func (e *Exporter) writeScan(out *bufio.Writer, scan *Scan) {
+	writeHeader(out, "idiot_scan_duration_seconds", "gauge", "Time taken by the latest scan.")
+	fmt.Fprintf(out, "idiot_scan_duration_seconds %s\n", formatFloat(scan.Duration.Seconds()))
+	writeHeader(out, "idiot_scan_timestamp_seconds", "gauge", "Time the latest scan started, in seconds since the Unix epoch.")
+	fmt.Fprintf(out, "idiot_scan_timestamp_seconds %d\n", scan.Time.Unix())
+	writeHeader(out, "idiot_devices_up", "gauge", "Number of devices found by the latest scan.")
+	fmt.Fprintf(out, "idiot_devices_up %d\n", len(scan.Devices))
+
+	writeHeader(out, "idiot_source_devices", "gauge", "Number of devices found by each discovery source in the latest scan.")
+	counts := make(map[string]int)
+	for _, device := range scan.Devices {
+		for _, source := range device.Sources {
+			counts[source]++
+		}
+	}
+	sources := slices.Clone(Sources)
+	for source := range counts {
+		if !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	for _, source := range sources {
+		fmt.Fprintf(out, "idiot_source_devices{source=%s} %d\n", quote(source), counts[source])
+	}
+
+	// Saved devices the scan did not find are reported as down, so that an alert can fire when one disappears.
+	writeHeader(out, "idiot_device_up", "gauge", "Whether the device was found by the latest scan. Saved devices that were not found are 0.")
+	for _, device := range scan.Devices {
+		fmt.Fprintf(out, "idiot_device_up%s 1\n", deviceLabels(device))
+	}
+	for _, saved := range scan.Saved {
+		if model.FindSameDevice(scan.Devices, &saved) == nil {
+			fmt.Fprintf(out, "idiot_device_up%s 0\n", deviceLabels(saved))
+		}
+	}
+
+	writeHeader(out, "idiot_device_icmp_rtt_seconds", "gauge", "Round trip time of the device's reply to ICMP echo in the latest scan.")
+	for _, device := range scan.Devices {
+		if device.IcmpRttMs > 0 {
+			fmt.Fprintf(out, "idiot_device_icmp_rtt_seconds%s %s\n", deviceLabels(device), formatFloat(device.IcmpRttMs/1000))
+		}
+	}
+	writeHeader(out, "idiot_device_ssh_port", "gauge", "Port of the SSH server found on the device in the latest scan.")
+	for _, device := range scan.Devices {
+		if device.CanConnectSSH {
+			fmt.Fprintf(out, "idiot_device_ssh_port%s %d\n", deviceLabels(device), device.SSHPort)
+		}
+	}
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric.
+func writeHeader(out *bufio.Writer, name, kind, help string) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// deviceLabels returns the labels that identify a device in the per-device metrics.
+func deviceLabels(device model.Device) string {
+	labels := []string{
+		"id=" + quote(device.ID),
+		"addr=" + quote(device.AddrV4),
+		"mac=" + quote(strings.ToLower(device.MAC)),
+		"hostname=" + quote(device.Hostname),
+		"name=" + quote(device.Name()),
+		"vendor=" + quote(device.Vendor),
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+// quote returns a label value quoted and escaped as the exposition format requires.
+func quote(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+	return `"` + value + `"`
+}
+
+// formatFloat formats a sample value with as few digits as needed.
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// TestExporter verifies the metrics written before and after scans are recorded.
+func TestExporter(t *testing.T) {
+	exporter := NewExporter([]string{"icmp", "mdns"})
+
+	buf := new(bytes.Buffer)
+	if err := exporter.Write(buf); err != nil {
+		t.Fatalf("Write() failed with %v", err)
+	}
+	if got := buf.String(); !strings.Contains(got, `idiot_phase_errors_total{phase="icmp"} 0`) || strings.Contains(got, "idiot_devices_up") {
+		t.Errorf("unexpected metrics before the first scan:\n%s", got)
+	}
+
+	pi := model.Device{ID: "mac:b8:27:eb:12:34:56", AddrV4: "192.168.1.20", MAC: "B8:27:EB:12:34:56", Hostname: "raspberrypi",
+		CanConnectSSH: true, SSHPort: 2222, IcmpRttMs: 1.5, Sources: []string{"ICMP", "ARP"}}
+	printer := model.Device{AddrV4: "192.168.1.30", Hostname: `printer "lobby"`, Sources: []string{"mDNS"}}
+	exporter.Record(Scan{Time: time.Unix(1792231200, 0), Duration: 4500 * time.Millisecond, FailedPhases: []string{"icmp"}})
+	exporter.Record(Scan{
+		Time:         time.Unix(1792231260, 0),
+		Duration:     5250 * time.Millisecond,
+		Devices:      []model.Device{pi, printer},
+		Saved:        []model.Device{{AddrV4: "192.168.1.20", MAC: "b8:27:eb:12:34:56"}, {AddrV4: "192.168.1.40", Alias: "garage-pi"}},
+		FailedPhases: []string{"icmp"},
+	})
+
+	buf.Reset()
+	if err := exporter.Write(buf); err != nil {
+		t.Fatalf("Write() failed with %v", err)
+	}
+	got := buf.String()
+	piLabels := `{id="mac:b8:27:eb:12:34:56",addr="192.168.1.20",mac="b8:27:eb:12:34:56",hostname="raspberrypi",name="raspberrypi",vendor=""}`
+	for _, want := range []string{
+		"idiot_scans_total 2",
+		`idiot_phase_errors_total{phase="icmp"} 2`,
+		`idiot_phase_errors_total{phase="mdns"} 0`,
+		"idiot_scan_duration_seconds 5.25",
+		"idiot_scan_timestamp_seconds 1792231260",
+		"idiot_devices_up 2",
+		`idiot_source_devices{source="ICMP"} 1`,
+		`idiot_source_devices{source="SSDP"} 0`,
+		"idiot_device_up" + piLabels + " 1",
+		`idiot_device_up{id="",addr="192.168.1.30",mac="",hostname="printer \"lobby\"",name="printer \"lobby\"",vendor=""} 1`,
+		`idiot_device_up{id="",addr="192.168.1.40",mac="",hostname="",name="garage-pi",vendor=""} 0`,
+		"idiot_device_icmp_rtt_seconds" + piLabels + " 0.0015",
+		"idiot_device_ssh_port" + piLabels + " 2222",
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("metrics are missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "idiot_device_up{") != 3 {
+		t.Errorf("expected the saved device that was found not to be reported twice:\n%s", got)
+	}
+}
@@ -0,0 +1,10 @@
+package model
+
+// PortBanner identifies the service listening on an open TCP port, from what it sent
+// when connected to or how it answered a protocol specific probe.
+type PortBanner struct {
+	Port     int    `yaml:"port" json:"port"`
+	Protocol string `yaml:"protocol" json:"protocol"`
+	Banner   string `yaml:"banner,omitempty" json:"banner,omitempty"`
+	Title    string `yaml:"title,omitempty" json:"title,omitempty"`
+}
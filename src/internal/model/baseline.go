@@ -0,0 +1,72 @@
+package model
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// BaselineEntry is a device known to belong on the network, identified by any of its MAC address,
+// IPv4 address and hostname. A device is matched on the most reliable field that both it and the
+// entry have: the MAC address, then the hostname, then the IPv4 address.
+type BaselineEntry struct {
+	MAC      string `yaml:"mac,omitempty" json:"mac,omitempty"`
+	AddrV4   string `yaml:"addrV4,omitempty" json:"addrV4,omitempty"`
+	Hostname string `yaml:"hostname,omitempty" json:"hostname,omitempty"`
+}
+
+// NewBaselineEntry returns the entry for a device found by a scan, with its MAC address, IPv4 address
+// and hostname, so that it is still recognised by a later scan that does not find all of them, such
+// as a scan of another subnet, which cannot see MAC addresses.
+func NewBaselineEntry(device Device) BaselineEntry {
+	return BaselineEntry{MAC: strings.ToLower(device.MAC), AddrV4: device.AddrV4, Hostname: device.Hostname}
+}
+
+// ParseBaselineEntry returns the entry for a MAC address, IPv4 address or hostname given by the user.
+func ParseBaselineEntry(ref string) BaselineEntry {
+	if mac, err := net.ParseMAC(ref); err == nil {
+		return BaselineEntry{MAC: mac.String()}
+	}
+	if addr, err := netip.ParseAddr(ref); err == nil && addr.Is4() {
+		return BaselineEntry{AddrV4: addr.String()}
+	}
+	return BaselineEntry{Hostname: ref}
+}
+
+// String returns the fields set on the entry, joined by ", ".
+func (e BaselineEntry) String() string {
+	var fields []string
+	for _, field := range []string{e.MAC, e.AddrV4, e.Hostname} {
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return strings.Join(fields, ", ")
+}
+
+// Matches reports whether the device is the one the entry describes, comparing the MAC address when
+// both have one, otherwise the hostname when both have one, and otherwise the IPv4 address. The
+// weaker fields are not compared once a stronger one has been, as a DHCP lease can move a known
+// device to a new address. An entry with no fields set matches nothing.
+func (e BaselineEntry) Matches(device *Device) bool {
+	switch {
+	case e.MAC != "" && device.MAC != "":
+		return strings.EqualFold(e.MAC, device.MAC)
+	case e.Hostname != "" && device.Hostname != "":
+		return strings.EqualFold(e.Hostname, device.Hostname)
+	case e.AddrV4 != "" && device.AddrV4 != "":
+		return e.AddrV4 == device.AddrV4
+	default:
+		return false
+	}
+}
+
+// InBaseline reports whether any entry of the baseline matches the device.
+func InBaseline(baseline []BaselineEntry, device *Device) bool {
+	for _, entry := range baseline {
+		if entry.Matches(device) {
+			return true
+		}
+	}
+	return false
+}
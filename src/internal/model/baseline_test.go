@@ -0,0 +1,50 @@
+package model
+
+import "testing"
+
+// TestBaselineEntry verifies how entries are made from devices and user input, and which devices they match.
+func TestBaselineEntry(t *testing.T) {
+	want := BaselineEntry{MAC: "b8:27:eb:12:34:56", AddrV4: "192.168.1.20", Hostname: "raspberrypi"}
+	if got := NewBaselineEntry(Device{AddrV4: "192.168.1.20", MAC: "B8:27:EB:12:34:56", Hostname: "raspberrypi"}); got != want {
+		t.Errorf("NewBaselineEntry() = %+v, want %+v", got, want)
+	}
+	for ref, want := range map[string]BaselineEntry{
+		"B8:27:EB:12:34:56": {MAC: "b8:27:eb:12:34:56"},
+		"192.168.1.30":      {AddrV4: "192.168.1.30"},
+		"printer.local":     {Hostname: "printer.local"},
+	} {
+		if got := ParseBaselineEntry(ref); got != want {
+			t.Errorf("ParseBaselineEntry(%q) = %+v, want %+v", ref, got, want)
+		}
+	}
+
+	baseline := []BaselineEntry{
+		{MAC: "b8:27:eb:12:34:56", AddrV4: "192.168.1.20", Hostname: "raspberrypi"},
+		{Hostname: "Printer"},
+		{AddrV4: "192.168.1.1", Hostname: "router"},
+		{MAC: "aa:bb:cc:dd:ee:ff", AddrV4: "192.168.1.50"},
+	}
+	tests := []struct {
+		device Device
+		want   bool
+	}{
+		{device: Device{AddrV4: "192.168.1.42", MAC: "B8:27:EB:12:34:56"}, want: true},
+		// Scanned from another subnet, without the MAC address.
+		{device: Device{AddrV4: "192.168.1.42", Hostname: "raspberrypi"}, want: true},
+		{device: Device{AddrV4: "192.168.1.50"}, want: true},
+		// A different device given the Pi's old address.
+		{device: Device{AddrV4: "192.168.1.20", MAC: "de:ad:be:ef:00:02"}, want: false},
+		{device: Device{AddrV4: "192.168.1.30", Hostname: "printer"}, want: true},
+		{device: Device{AddrV4: "192.168.1.1", Hostname: "router"}, want: true},
+		{device: Device{AddrV4: "192.168.1.1", Hostname: "impostor"}, want: false},
+		{device: Device{AddrV4: "192.168.1.66", MAC: "de:ad:be:ef:00:01"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := InBaseline(baseline, &tt.device); got != tt.want {
+			t.Errorf("InBaseline(%+v) = %v, want %v", tt.device, got, tt.want)
+		}
+	}
+	if (BaselineEntry{}).Matches(&Device{AddrV4: "192.168.1.20"}) {
+		t.Error("an empty entry should match nothing")
+	}
+}
@@ -1,16 +1,39 @@
 package model
 
+// DefaultScanPorts are the TCP ports probed by the scan command when none are configured:
+// SSH, Telnet, HTTP, HTTPS, MQTT, MQTT over TLS, CoAP over TCP, HTTP alternate and RTSP.
+var DefaultScanPorts = []int{22, 23, 80, 443, 1883, 8883, 5683, 8080, 554}
+
+// DefaultSshAuthMethods is the order SSH authentication methods are tried in when none is configured.
+var DefaultSshAuthMethods = []string{"agent", "publickey", "keyboard-interactive", "password"}
+
 type Config struct {
-	SelectedDevices []interface{} `yaml:"selected_devices,omitempty"`
-	Debug           bool          `yaml:"debug"`
-	SshSecureMode   bool          `yaml:"ssh_secure_mode"`
+	SelectedDevices     []interface{} `yaml:"selected_devices,omitempty"`
+	Debug               bool          `yaml:"debug"`
+	SshSecureMode       bool          `yaml:"ssh_secure_mode"`
+	SshAuthMethods      []string      `yaml:"ssh_auth_methods"`
+	OuiFile             string        `yaml:"oui_file"`
+	ScanPorts           []int         `yaml:"scan_ports"`
+	PortScanConcurrency int           `yaml:"port_scan_concurrency"`
+	PortScanTimeout     string        `yaml:"port_scan_timeout"`
+	GrabBanners         bool          `yaml:"grab_banners"`
+	HistoryLimit        int           `yaml:"history_limit"`
+	ApiToken            string        `yaml:"api_token"`
 }
 
 // NewConfig creates and returns a new Config struct with default values.
 func NewConfig() *Config {
 	return &Config{
-		SelectedDevices: []interface{}{},
-		Debug:           false,
-		SshSecureMode:   true,
+		SelectedDevices:     []interface{}{},
+		Debug:               false,
+		SshSecureMode:       true,
+		SshAuthMethods:      DefaultSshAuthMethods,
+		OuiFile:             "",
+		ScanPorts:           DefaultScanPorts,
+		PortScanConcurrency: 100,
+		PortScanTimeout:     "1s",
+		GrabBanners:         true,
+		HistoryLimit:        100,
+		ApiToken:            "",
 	}
 }
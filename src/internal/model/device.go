@@ -1,12 +1,35 @@
 package model
 
+import (
+	"slices"
+	"strings"
+)
+
+// Device is a device found on the network. Its JSON and YAML keys form the schema used
+// both in the configuration file and in the structured output of the scan command.
 type Device struct {
-	AddrV4        string   `yaml:"addrV4"`
-	AddrV6        string   `yaml:"addrV6,omitempty"`
-	MAC           string   `yaml:"mac,omitempty"`
-	Hostname      string   `yaml:"hostname"`
-	CanConnectSSH bool     `yaml:"canConnectSSH"`
-	Sources       []string `yaml:"sources"`
+	ID            string       `yaml:"id,omitempty" json:"id,omitempty"`
+	AddrV4        string       `yaml:"addrV4" json:"addrV4"`
+	AddrV6        string       `yaml:"addrV6,omitempty" json:"addrV6,omitempty"`
+	MAC           string       `yaml:"mac,omitempty" json:"mac,omitempty"`
+	Vendor        string       `yaml:"vendor,omitempty" json:"vendor,omitempty"`
+	Hostname      string       `yaml:"hostname" json:"hostname"`
+	Alias         string       `yaml:"alias,omitempty" json:"alias,omitempty"`
+	Tags          []string     `yaml:"tags,omitempty" json:"tags,omitempty"`
+	CanConnectSSH bool         `yaml:"canConnectSSH" json:"canConnectSSH"`
+	SSHPort       int          `yaml:"sshPort,omitempty" json:"sshPort,omitempty"`
+	HostKey       string       `yaml:"hostKey,omitempty" json:"hostKey,omitempty"`
+	User          string       `yaml:"user,omitempty" json:"user,omitempty"`
+	IdentityFile  string       `yaml:"identityFile,omitempty" json:"identityFile,omitempty"`
+	JumpHosts     []string     `yaml:"jumpHosts,omitempty" json:"jumpHosts,omitempty"`
+	IcmpRttMs     float64      `yaml:"icmpRttMs,omitempty" json:"icmpRttMs,omitempty"`
+	OpenPorts     []int        `yaml:"openPorts,omitempty" json:"openPorts,omitempty"`
+	Banners       []PortBanner `yaml:"banners,omitempty" json:"banners,omitempty"`
+	Sources       []string     `yaml:"sources" json:"sources"`
+	Services      []Service    `yaml:"services,omitempty" json:"services,omitempty"`
+	UPnP          *UPnPDevice  `yaml:"upnp,omitempty" json:"upnp,omitempty"`
+	// Unknown is set by scan --against-baseline on devices that are not in the baseline.
+	Unknown bool `yaml:"unknown,omitempty" json:"unknown,omitempty"`
 }
 
 // AddSource appends a discovery source (e.g., "ICMP", "mDNS") to the device's
@@ -20,13 +43,147 @@ func (d *Device) AddSource(source string) {
 	d.Sources = append(d.Sources, source)
 }
 
-// ListToMap converts a slice of Device structs into a map where the key is the
-// device's IPv4 address. This allows for efficient lookups.
+// AddService records a service advertised by the device. A service with the same type
+// and instance name replaces the existing one, so repeated announcements do not duplicate it.
+func (d *Device) AddService(service Service) {
+	for i, s := range d.Services {
+		if s.Type == service.Type && s.Instance == service.Instance {
+			d.Services[i] = service
+			return
+		}
+	}
+	d.Services = append(d.Services, service)
+}
+
+// Name returns the name to show for the device: its alias, hostname or IPv4 address, whichever is set first.
+func (d *Device) Name() string {
+	if d.Alias != "" {
+		return d.Alias
+	}
+	if d.Hostname != "" {
+		return d.Hostname
+	}
+	return d.AddrV4
+}
+
+// HasTag reports whether the device has the tag, ignoring case.
+func (d *Device) HasTag(tag string) bool {
+	for _, t := range d.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// IdentityKeys returns the identifiers of the device that stay the same when its address changes,
+// most reliable first: "mac:<MAC address>", "mdns:<instance>.<service type>" for each mDNS service
+// it advertises, and "hostkey:<SHA256 fingerprint>" of its SSH host key. They are lower cased,
+// except for the fingerprint, which is case sensitive.
+func (d *Device) IdentityKeys() []string {
+	var keys []string
+	if d.MAC != "" {
+		keys = append(keys, "mac:"+strings.ToLower(d.MAC))
+	}
+	var instances []string
+	for _, service := range d.Services {
+		if service.Instance != "" {
+			instances = append(instances, "mdns:"+strings.ToLower(service.Instance+"."+service.Type))
+		}
+	}
+	slices.Sort(instances)
+	keys = append(keys, slices.Compact(instances)...)
+	if d.HostKey != "" {
+		keys = append(keys, "hostkey:"+d.HostKey)
+	}
+	return keys
+}
+
+// StableID returns the most reliable of the device's identity keys, or an empty string when it
+// has none, in which case the device can only be recognised by its address.
+func (d *Device) StableID() string {
+	if keys := d.IdentityKeys(); len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+// SameDevice reports whether a and b are the same device, because they have the same ID or share
+// an identity key. Devices without either are never the same, whatever their addresses. Devices
+// flashed from the same image share an SSH host key, so a host key alone does not make two
+// devices with different MAC addresses the same.
+func SameDevice(a, b *Device) bool {
+	macsDiffer := a.MAC != "" && b.MAC != "" && !strings.EqualFold(a.MAC, b.MAC)
+	identifies := func(key string) bool {
+		return !macsDiffer || !strings.HasPrefix(key, "hostkey:")
+	}
+	if a.ID != "" && a.ID == b.ID && identifies(a.ID) {
+		return true
+	}
+	keysA, keysB := a.IdentityKeys(), b.IdentityKeys()
+	if a.ID != "" {
+		keysA = append(keysA, a.ID)
+	}
+	if b.ID != "" {
+		keysB = append(keysB, b.ID)
+	}
+	for _, key := range keysA {
+		if slices.Contains(keysB, key) && identifies(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasIdentity reports whether the device has a stable ID or identity key.
+func (d *Device) HasIdentity() bool {
+	return d.ID != "" || len(d.IdentityKeys()) > 0
+}
+
+// FindSameDevice returns the device in devices that is the same as device, or nil if there is
+// none. Devices are matched by SameDevice, and by IPv4 address when either has no identity, such
+// as a device saved before IDs were recorded.
+func FindSameDevice(devices []Device, device *Device) *Device {
+	for i := range devices {
+		if SameDevice(&devices[i], device) {
+			return &devices[i]
+		}
+	}
+	for i := range devices {
+		if devices[i].AddrV4 == device.AddrV4 && (!devices[i].HasIdentity() || !device.HasIdentity()) {
+			return &devices[i]
+		}
+	}
+	return nil
+}
+
+// ListToMap converts a slice of Device structs into a map where the key is the device's
+// stable ID, or its IPv4 address when it has none. This allows for efficient lookups.
 func ListToMap(devices []Device) map[string]*Device {
 	deviceMap := make(map[string]*Device)
 	for i := range devices {
 		device := &devices[i]
-		deviceMap[device.AddrV4] = device
+		key := device.ID
+		if key == "" {
+			key = device.AddrV4
+		}
+		deviceMap[key] = device
 	}
 	return deviceMap
 }
+
+// FindDevice returns the device whose IPv4 address, alias, hostname or MAC address matches ref,
+// ignoring case, or nil if there is none. This lets commands accept any of the names a user
+// is likely to know a saved device by.
+func FindDevice(devices []Device, ref string) *Device {
+	for i := range devices {
+		device := &devices[i]
+		if device.AddrV4 == ref ||
+			(device.Alias != "" && strings.EqualFold(device.Alias, ref)) ||
+			(device.Hostname != "" && strings.EqualFold(device.Hostname, ref)) ||
+			(device.MAC != "" && strings.EqualFold(device.MAC, ref)) {
+			return device
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package model
+
+import "testing"
+
+// TestFindDevice verifies that a saved device can be found by IPv4 address, alias, hostname or MAC address.
+func TestFindDevice(t *testing.T) {
+	devices := []Device{
+		{AddrV4: "192.168.1.10", Hostname: "printer.local", MAC: "aa:bb:cc:dd:ee:ff"},
+		{AddrV4: "192.168.1.20", Hostname: "raspberrypi", Alias: "garage-pi"},
+	}
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{ref: "192.168.1.20", want: "192.168.1.20"},
+		{ref: "RaspberryPi", want: "192.168.1.20"},
+		{ref: "Garage-Pi", want: "192.168.1.20"},
+		{ref: "AA:BB:CC:DD:EE:FF", want: "192.168.1.10"},
+		{ref: "192.168.1.30", want: ""},
+		{ref: "", want: ""},
+	}
+	for _, tt := range tests {
+		got := FindDevice(devices, tt.ref)
+		if (got == nil && tt.want != "") || (got != nil && got.AddrV4 != tt.want) {
+			t.Errorf("FindDevice(%q) = %v, want %q", tt.ref, got, tt.want)
+		}
+	}
+}
+
+// TestDeviceName verifies that a device is named by its alias, then hostname, then IPv4 address.
+func TestDeviceName(t *testing.T) {
+	tests := []struct {
+		device Device
+		want   string
+	}{
+		{device: Device{AddrV4: "192.168.1.20", Hostname: "raspberrypi", Alias: "garage-pi"}, want: "garage-pi"},
+		{device: Device{AddrV4: "192.168.1.20", Hostname: "raspberrypi"}, want: "raspberrypi"},
+		{device: Device{AddrV4: "192.168.1.20"}, want: "192.168.1.20"},
+	}
+	for _, tt := range tests {
+		if got := tt.device.Name(); got != tt.want {
+			t.Errorf("Name() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+// TestSameDevice verifies that devices are matched by their identity keys rather than their addresses.
+func TestSameDevice(t *testing.T) {
+	pi := Device{AddrV4: "192.168.1.20", MAC: "B8:27:EB:12:34:56", HostKey: "SHA256:abc"}
+	cast := Device{AddrV4: "192.168.1.30", Services: []Service{{Instance: "Living Room", Type: "_googlecast._tcp"}}}
+
+	if got := pi.IdentityKeys(); len(got) != 2 || got[0] != "mac:b8:27:eb:12:34:56" || got[1] != "hostkey:SHA256:abc" {
+		t.Errorf("IdentityKeys() = %v", got)
+	}
+	if got := cast.StableID(); got != "mdns:living room._googlecast._tcp" {
+		t.Errorf("StableID() = %q", got)
+	}
+
+	tests := []struct {
+		name string
+		a, b Device
+		want bool
+	}{
+		{name: "same MAC, new address", a: pi, b: Device{AddrV4: "192.168.1.42", MAC: "b8:27:eb:12:34:56"}, want: true},
+		{name: "same host key", a: pi, b: Device{AddrV4: "192.168.1.42", HostKey: "SHA256:abc"}, want: true},
+		{name: "same host key, different MAC", a: pi, b: Device{AddrV4: "192.168.1.42", MAC: "d8:3a:dd:12:34:56", HostKey: "SHA256:abc"}, want: false},
+		{name: "host key ID, different MAC", a: Device{ID: "hostkey:SHA256:abc", MAC: "b8:27:eb:12:34:56"}, b: Device{ID: "hostkey:SHA256:abc", MAC: "d8:3a:dd:12:34:56"}, want: false},
+		{name: "same mDNS instance", a: cast, b: Device{AddrV4: "192.168.1.43", Services: []Service{{Instance: "living room", Type: "_googlecast._tcp"}}}, want: true},
+		{name: "saved ID", a: Device{ID: "mac:b8:27:eb:12:34:56"}, b: pi, want: true},
+		{name: "different devices", a: pi, b: cast, want: false},
+		{name: "same address only", a: Device{AddrV4: "192.168.1.20"}, b: Device{AddrV4: "192.168.1.20"}, want: false},
+	}
+	for _, tt := range tests {
+		if got := SameDevice(&tt.a, &tt.b); got != tt.want {
+			t.Errorf("%s: SameDevice() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
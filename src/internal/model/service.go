@@ -0,0 +1,10 @@
+package model
+
+// Service is a DNS-SD service advertised by a device over mDNS, e.g. a Chromecast's "_googlecast._tcp".
+type Service struct {
+	Instance string            `yaml:"instance" json:"instance"`
+	Type     string            `yaml:"type" json:"type"`
+	Port     int               `yaml:"port" json:"port"`
+	Target   string            `yaml:"target,omitempty" json:"target,omitempty"`
+	TXT      map[string]string `yaml:"txt,omitempty" json:"txt,omitempty"`
+}
@@ -0,0 +1,10 @@
+package model
+
+// UPnPDevice holds the identity a device reports in its UPnP device description, found via SSDP.
+type UPnPDevice struct {
+	FriendlyName string `yaml:"friendlyName,omitempty" json:"friendlyName,omitempty"`
+	Manufacturer string `yaml:"manufacturer,omitempty" json:"manufacturer,omitempty"`
+	ModelName    string `yaml:"modelName,omitempty" json:"modelName,omitempty"`
+	ModelNumber  string `yaml:"modelNumber,omitempty" json:"modelNumber,omitempty"`
+	SerialNumber string `yaml:"serialNumber,omitempty" json:"serialNumber,omitempty"`
+}
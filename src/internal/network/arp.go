@@ -0,0 +1,138 @@
+package network
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// macPattern matches MAC addresses written with either ':' or '-' separators, including the
+// shortened form used by macOS where leading zeros are dropped (e.g. "a:b:c:d:e:f").
+var macPattern = regexp.MustCompile(`([0-9a-fA-F]{1,2}[:-]){5}[0-9a-fA-F]{1,2}`)
+
+// ipv4Pattern matches a dotted-quad IPv4 address.
+var ipv4Pattern = regexp.MustCompile(`\b(\d{1,3}\.){3}\d{1,3}\b`)
+
+// PerformArpScan discovers hosts on the local network by sending ARP requests to each of the given IPs.
+// Unlike ICMP, ARP cannot be ignored by a device that wants to use the network, so this finds hosts that drop pings.
+// Where raw ARP is not available (unsupported platform or missing privileges) it falls back to priming the
+// operating system's neighbour table with UDP packets and reading the MAC addresses back from it.
+// An error is returned if the neighbour table could not be read either.
+func PerformArpScan(iface *net.Interface, ips []net.IP, discoveredDevices map[string]*model.Device, mu *sync.Mutex) error {
+	if len(ips) == 0 {
+		return nil
+	}
+
+	err := arpScan(iface, ips, discoveredDevices, mu)
+	if err == nil {
+		return nil
+	}
+	log.Debug().Msgf("Raw ARP scan unavailable, falling back to the neighbour table: %v", err)
+
+	primeNeighbourTable(ips)
+	neighbours, err := readNeighbourTable()
+	if err != nil {
+		log.Error().Msgf("Failed to read the neighbour table: %v", err)
+		return err
+	}
+
+	// Only keep entries for the addresses being scanned, the table may hold entries for other networks.
+	targets := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		targets[ip.String()] = true
+	}
+	for ipStr, mac := range neighbours {
+		if targets[ipStr] {
+			recordArpReply(net.ParseIP(ipStr), mac, discoveredDevices, mu)
+		}
+	}
+	return nil
+}
+
+// recordArpReply safely adds or updates a device in the shared map with the MAC address it answered from.
+func recordArpReply(ip net.IP, mac net.HardwareAddr, discoveredDevices map[string]*model.Device, mu *sync.Mutex) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ipStr := ip.String()
+	device, exists := discoveredDevices[ipStr]
+	if !exists {
+		device = &model.Device{AddrV4: ipStr}
+		discoveredDevices[ipStr] = device
+	}
+	if device.MAC == "" {
+		device.MAC = mac.String()
+	}
+	device.AddSource("ARP")
+}
+
+// primeNeighbourTable sends a single UDP datagram to every IP so the operating system resolves,
+// and caches, the MAC address of each host that is present. The discard port is used as nothing
+// needs to be listening for the ARP exchange to happen.
+func primeNeighbourTable(ips []net.IP) {
+	for _, ip := range ips {
+		conn, err := net.Dial("udp4", net.JoinHostPort(ip.String(), "9"))
+		if err != nil {
+			continue
+		}
+		_, _ = conn.Write([]byte{0})
+		_ = conn.Close()
+		time.Sleep(sendInterval) // Small delay to avoid flooding the network.
+	}
+	// Give the outstanding ARP requests a moment to be answered.
+	time.Sleep(1 * time.Second)
+}
+
+// parseNeighbourTable extracts IP to MAC pairs from the text output of a neighbour table, such as
+// /proc/net/arp on Linux or `arp -a` on Windows and macOS. Incomplete and broadcast entries are skipped.
+func parseNeighbourTable(output string) map[string]net.HardwareAddr {
+	neighbours := make(map[string]net.HardwareAddr)
+	for _, line := range strings.Split(output, "\n") {
+		ipStr := ipv4Pattern.FindString(line)
+		macStr := macPattern.FindString(line)
+		if ipStr == "" || macStr == "" {
+			continue
+		}
+		mac, err := normaliseMAC(macStr)
+		if err != nil || isZeroOrBroadcastMAC(mac) {
+			continue
+		}
+		neighbours[ipStr] = mac
+	}
+	return neighbours
+}
+
+// normaliseMAC parses a MAC address that may use '-' separators or omit leading zeros.
+func normaliseMAC(macStr string) (net.HardwareAddr, error) {
+	octets := strings.FieldsFunc(macStr, func(r rune) bool { return r == ':' || r == '-' })
+	for i, octet := range octets {
+		if len(octet) == 1 {
+			octets[i] = "0" + octet
+		}
+	}
+	return net.ParseMAC(strings.Join(octets, ":"))
+}
+
+// isZeroOrBroadcastMAC reports whether a MAC address is all zeros (an incomplete entry) or all ones (broadcast).
+func isZeroOrBroadcastMAC(mac net.HardwareAddr) bool {
+	zero, broadcast := true, true
+	for _, b := range mac {
+		zero = zero && b == 0x00
+		broadcast = broadcast && b == 0xff
+	}
+	return zero || broadcast
+}
+
+// interfaceIPv4 returns the first IPv4 address assigned to the given interface.
+func interfaceIPv4(iface *net.Interface) net.IP {
+	if ipNet := interfaceIPv4Net(iface); ipNet != nil {
+		return ipNet.IP.To4()
+	}
+	return nil
+}
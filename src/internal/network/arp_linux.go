@@ -0,0 +1,153 @@
+//go:build linux
+
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sys/unix"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+const (
+	ethHeaderLen = 14
+	arpPacketLen = 28
+	arpOpRequest = 1
+	arpOpReply   = 2
+)
+
+// arpScan sends an ARP request for each IP out of the given interface using a raw AF_PACKET socket,
+// and records every reply received until the last request has had time to be answered. This requires CAP_NET_RAW.
+func arpScan(iface *net.Interface, ips []net.IP, discoveredDevices map[string]*model.Device, mu *sync.Mutex) error {
+	if iface == nil || len(iface.HardwareAddr) != 6 {
+		return errors.New("interface has no ethernet hardware address")
+	}
+	srcIP := interfaceIPv4(iface)
+	if srcIP == nil {
+		return fmt.Errorf("interface %s has no IPv4 address", iface.Name)
+	}
+
+	// The protocol must be given in network byte order.
+	proto := htons(unix.ETH_P_ARP)
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, int(proto))
+	if err != nil {
+		return fmt.Errorf("failed to open raw socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	addr := &unix.SockaddrLinklayer{Protocol: proto, Ifindex: iface.Index}
+	if err := unix.Bind(fd, addr); err != nil {
+		return fmt.Errorf("failed to bind raw socket to %s: %w", iface.Name, err)
+	}
+
+	// Set a short receive timeout so the reader can check the context cancellation status.
+	timeout := unix.NsecToTimeval((100 * time.Millisecond).Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &timeout); err != nil {
+		return fmt.Errorf("failed to set socket timeout: %w", err)
+	}
+
+	// Read the replies in a dedicated goroutine while the requests are sent.
+	sendThenListen(func() {
+		for _, ip := range ips {
+			frame := buildArpRequest(iface.HardwareAddr, srcIP, ip)
+			if err := unix.Sendto(fd, frame, 0, addr); err != nil {
+				log.Debug().Msgf("ARP send to %s failed: %v", ip, err)
+			}
+			time.Sleep(sendInterval) // Small delay to avoid flooding the network.
+		}
+	}, func(ctx context.Context) {
+		readArpReplies(ctx, fd, discoveredDevices, mu)
+	})
+	return nil
+}
+
+// readArpReplies runs in a dedicated goroutine, listening for ARP replies until the context is cancelled.
+func readArpReplies(ctx context.Context, fd int, discoveredDevices map[string]*model.Device, mu *sync.Mutex) {
+	buf := make([]byte, 1500)
+
+	for {
+		select {
+		case <-ctx.Done(): // The scan timeout has been reached.
+			return
+		default:
+			n, _, err := unix.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+					continue // Expected timeout, continue loop to check context.
+				}
+				log.Debug().Msgf("ARP read error: %v", err)
+				return // Other errors are fatal for the reader.
+			}
+
+			ip, mac, ok := parseArpReply(buf[:n])
+			if ok {
+				recordArpReply(ip, mac, discoveredDevices, mu)
+			}
+		}
+	}
+}
+
+// buildArpRequest constructs a broadcast ethernet frame carrying an ARP "who-has" request for the target IP.
+func buildArpRequest(srcMAC net.HardwareAddr, srcIP, dstIP net.IP) []byte {
+	frame := make([]byte, ethHeaderLen+arpPacketLen)
+
+	// Ethernet header: broadcast destination, our source, ARP ethertype.
+	copy(frame[0:6], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(frame[6:12], srcMAC)
+	binary.BigEndian.PutUint16(frame[12:14], unix.ETH_P_ARP)
+
+	// ARP payload for IPv4 over ethernet.
+	arp := frame[ethHeaderLen:]
+	binary.BigEndian.PutUint16(arp[0:2], 1)      // Hardware type: ethernet.
+	binary.BigEndian.PutUint16(arp[2:4], 0x0800) // Protocol type: IPv4.
+	arp[4] = 6                                   // Hardware address length.
+	arp[5] = 4                                   // Protocol address length.
+	binary.BigEndian.PutUint16(arp[6:8], arpOpRequest)
+	copy(arp[8:14], srcMAC)
+	copy(arp[14:18], srcIP.To4())
+	// The target hardware address (arp[18:24]) is left zeroed, as it is what we are asking for.
+	copy(arp[24:28], dstIP.To4())
+	return frame
+}
+
+// parseArpReply extracts the sender IP and MAC address from an ethernet frame if it is an ARP reply.
+func parseArpReply(frame []byte) (net.IP, net.HardwareAddr, bool) {
+	if len(frame) < ethHeaderLen+arpPacketLen {
+		return nil, nil, false
+	}
+	if binary.BigEndian.Uint16(frame[12:14]) != unix.ETH_P_ARP {
+		return nil, nil, false
+	}
+	arp := frame[ethHeaderLen:]
+	if binary.BigEndian.Uint16(arp[6:8]) != arpOpReply {
+		return nil, nil, false
+	}
+	mac := make(net.HardwareAddr, 6)
+	copy(mac, arp[8:14])
+	ip := make(net.IP, 4)
+	copy(ip, arp[14:18])
+	return ip, mac, true
+}
+
+// readNeighbourTable reads the kernel's IPv4 neighbour table from /proc/net/arp.
+func readNeighbourTable() (map[string]net.HardwareAddr, error) {
+	data, err := os.ReadFile("/proc/net/arp")
+	if err != nil {
+		return nil, err
+	}
+	return parseNeighbourTable(string(data)), nil
+}
+
+// htons converts a uint16 from host to network byte order.
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
@@ -0,0 +1,28 @@
+//go:build !linux
+
+package network
+
+import (
+	"errors"
+	"net"
+	"os/exec"
+	"sync"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// arpScan is not implemented for non-Linux systems, as sending raw ethernet frames needs a
+// platform specific packet capture driver. The caller falls back to the neighbour table instead.
+func arpScan(_ *net.Interface, _ []net.IP, _ map[string]*model.Device, _ *sync.Mutex) error {
+	return errors.New("raw ARP is only supported on linux")
+}
+
+// readNeighbourTable reads the operating system's neighbour table using the `arp -a` command,
+// which is available on both Windows and macOS.
+func readNeighbourTable() (map[string]net.HardwareAddr, error) {
+	output, err := exec.Command("arp", "-a").Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseNeighbourTable(string(output)), nil
+}
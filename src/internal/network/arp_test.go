@@ -0,0 +1,33 @@
+package network
+
+import (
+	"testing"
+)
+
+// TestParseNeighbourTable verifies that MAC addresses are extracted from the neighbour table formats
+// of each supported operating system, and that incomplete and broadcast entries are skipped.
+func TestParseNeighbourTable(t *testing.T) {
+	output := `IP address       HW type     Flags       HW address            Mask     Device
+192.168.1.1      0x1         0x2         aa:bb:cc:dd:ee:01     *        eth0
+192.168.1.2      0x1         0x0         00:00:00:00:00:00     *        eth0
+Interface: 192.168.1.5 --- 0x3
+  192.168.1.3           aa-bb-cc-dd-ee-03     dynamic
+  192.168.1.255         ff-ff-ff-ff-ff-ff     static
+? (192.168.1.4) at a:b:c:d:e:4 on en0 ifscope [ethernet]`
+
+	got := parseNeighbourTable(output)
+	expected := map[string]string{
+		"192.168.1.1": "aa:bb:cc:dd:ee:01",
+		"192.168.1.3": "aa:bb:cc:dd:ee:03",
+		"192.168.1.4": "0a:0b:0c:0d:0e:04",
+	}
+
+	if len(got) != len(expected) {
+		t.Fatalf("unexpected number of neighbours.\ngot:  %v\nwant: %v", got, expected)
+	}
+	for ip, mac := range expected {
+		if got[ip].String() != mac {
+			t.Errorf("unexpected MAC for %s.\ngot:  %q\nwant: %q", ip, got[ip], mac)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+const (
+	// maxBannerLength caps how much of a banner is kept, so a chatty service cannot bloat the output.
+	maxBannerLength = 200
+	// telnetIAC marks the start of a telnet option negotiation command.
+	telnetIAC = 255
+)
+
+// titlePattern extracts the contents of an HTML <title> element.
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// mqttConnectPacket is an MQTT 3.1.1 CONNECT packet with a clean session, a 60 second
+// keep alive and the client ID "idiot".
+var mqttConnectPacket = []byte{
+	0x10, 0x11, // Fixed header: CONNECT, remaining length 17.
+	0x00, 0x04, 'M', 'Q', 'T', 'T', // Protocol name.
+	0x04,       // Protocol level 3.1.1.
+	0x02,       // Connect flags: clean session.
+	0x00, 0x3c, // Keep alive: 60 seconds.
+	0x00, 0x05, 'i', 'd', 'i', 'o', 't', // Client ID.
+}
+
+// mqttConnackCodes describes the return codes of an MQTT 3.1.1 CONNACK packet.
+var mqttConnackCodes = map[byte]string{
+	0: "accepted",
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad username or password",
+	5: "not authorized",
+}
+
+// PerformBannerGrab connects to every open port found by the port scan and identifies the
+// protocol being spoken. Services that talk first (SSH, Telnet, FTP) are identified from their
+// greeting. Silent services are sent a probe chosen by port number: MQTT CONNECT, RTSP OPTIONS,
+// or an HTTP GET, over TLS for the well known TLS ports. At most opts.Concurrency connections
+// are open at once, each limited by opts.Timeout.
+func PerformBannerGrab(discoveredDevices map[string]*model.Device, mu *sync.Mutex, opts PortScanOptions) {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	probes := make(chan portProbe)
+	var wg sync.WaitGroup
+
+	// Start a fixed pool of workers so the number of open sockets stays bounded.
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for probe := range probes {
+				banner := grabBanner(probe.device.AddrV4, probe.port, opts.Timeout)
+				mu.Lock()
+				probe.device.Banners = append(probe.device.Banners, banner)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, device := range discoveredDevices {
+		for _, port := range device.OpenPorts {
+			probes <- portProbe{device: device, port: port}
+		}
+	}
+	close(probes)
+	wg.Wait()
+
+	// Sort the banners by port so the output is stable regardless of which probe finished first.
+	for _, device := range discoveredDevices {
+		slices.SortFunc(device.Banners, func(a, b model.PortBanner) int { return a.Port - b.Port })
+	}
+}
+
+// grabBanner identifies the service on a single port. It always returns a result, with the
+// protocol set to "unknown" if nothing could be identified.
+func grabBanner(host string, port int, timeout time.Duration) model.PortBanner {
+	result := model.PortBanner{Port: port, Protocol: "unknown"}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return result
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(3 * timeout))
+
+	// Give the server a chance to speak first.
+	greeting := readGreeting(conn, timeout)
+	if len(greeting) > 0 {
+		return identifyGreeting(conn, greeting, result, timeout)
+	}
+
+	// The server is waiting for us, so send a probe based on the port.
+	_ = conn.SetDeadline(time.Now().Add(3 * timeout))
+	switch port {
+	case 1883:
+		return probeMqtt(conn, result)
+	case 8883:
+		return probeMqtt(tlsClient(conn, host), result)
+	case 554, 8554:
+		return probeRtsp(conn, host, port, result)
+	case 443, 8443:
+		return probeHTTP(tlsClient(conn, host), host, "https", result)
+	default:
+		return probeHTTP(conn, host, "http", result)
+	}
+}
+
+// readGreeting waits briefly for the server to send data before the client has said anything.
+func readGreeting(conn net.Conn, timeout time.Duration) []byte {
+	buf := make([]byte, 1024)
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	n, _ := conn.Read(buf)
+	return buf[:n]
+}
+
+// identifyGreeting works out the protocol from the first bytes a server sent unprompted.
+func identifyGreeting(conn net.Conn, greeting []byte, result model.PortBanner, timeout time.Duration) model.PortBanner {
+	switch {
+	case bytes.HasPrefix(greeting, []byte("SSH-")):
+		result.Protocol = "ssh"
+	case greeting[0] == telnetIAC:
+		result.Protocol = "telnet"
+		greeting = readTelnetPrompt(conn, greeting, timeout)
+	case bytes.HasPrefix(greeting, []byte("220")):
+		// FTP and SMTP both greet with 220, the banner text tells them apart.
+		result.Protocol = "ftp"
+		if bytes.Contains(bytes.ToUpper(greeting), []byte("SMTP")) {
+			result.Protocol = "smtp"
+		}
+	case looksLikeLoginPrompt(greeting):
+		result.Protocol = "telnet"
+	}
+	result.Banner = cleanBanner(greeting)
+	return result
+}
+
+// readTelnetPrompt refuses every option the telnet server asks for, so that it moves on
+// to sending its login prompt, and returns all the text it sent with the commands removed.
+func readTelnetPrompt(conn net.Conn, greeting []byte, timeout time.Duration) []byte {
+	var text []byte
+	data := greeting
+	for attempt := 0; attempt < 3; attempt++ {
+		plain, reply := parseTelnetCommands(data)
+		text = append(text, plain...)
+		if len(reply) > 0 {
+			_, _ = conn.Write(reply)
+		}
+		if looksLikeLoginPrompt(text) {
+			break
+		}
+		data = readGreeting(conn, timeout)
+		if len(data) == 0 {
+			break
+		}
+	}
+	return text
+}
+
+// parseTelnetCommands separates telnet commands from text. It returns the text and a reply
+// that refuses every DO and WILL request (RFC 854).
+func parseTelnetCommands(data []byte) ([]byte, []byte) {
+	var text, reply []byte
+	for i := 0; i < len(data); i++ {
+		if data[i] != telnetIAC || i+1 >= len(data) {
+			text = append(text, data[i])
+			continue
+		}
+		command := data[i+1]
+		switch {
+		case command == 253 && i+2 < len(data): // DO -> WONT
+			reply = append(reply, telnetIAC, 252, data[i+2])
+			i += 2
+		case command == 251 && i+2 < len(data): // WILL -> DONT
+			reply = append(reply, telnetIAC, 254, data[i+2])
+			i += 2
+		case (command == 252 || command == 254) && i+2 < len(data): // WONT and DONT need no reply.
+			i += 2
+		case command == 250: // Subnegotiation, skip to IAC SE.
+			end := bytes.Index(data[i:], []byte{telnetIAC, 240})
+			if end < 0 {
+				return text, reply
+			}
+			i += end + 1
+		default:
+			i++
+		}
+	}
+	return text, reply
+}
+
+// looksLikeLoginPrompt reports whether the text ends with a typical telnet login prompt.
+func looksLikeLoginPrompt(text []byte) bool {
+	lower := strings.ToLower(strings.TrimSpace(string(text)))
+	return strings.HasSuffix(lower, "login:") || strings.HasSuffix(lower, "username:") || strings.HasSuffix(lower, "password:")
+}
+
+// probeHTTP sends a GET request for the root page and records the Server header and page title.
+func probeHTTP(conn net.Conn, host, scheme string, result model.PortBanner) model.PortBanner {
+	request := fmt.Sprintf("GET / HTTP/1.0\r\nHost: %s\r\nUser-Agent: idiot\r\nConnection: close\r\n\r\n", host)
+	if _, err := io.WriteString(conn, request); err != nil {
+		return result
+	}
+	response, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return result
+	}
+	defer response.Body.Close()
+
+	result.Protocol = scheme
+	result.Banner = cleanBanner([]byte(response.Header.Get("Server")))
+	// Limit the body size, the title is near the top of any page.
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	if match := titlePattern.FindSubmatch(body); match != nil {
+		result.Title = cleanBanner(match[1])
+	}
+	return result
+}
+
+// probeMqtt sends an MQTT CONNECT and records the CONNACK return code. A code of 0 means
+// the broker accepts anonymous clients.
+func probeMqtt(conn net.Conn, result model.PortBanner) model.PortBanner {
+	if _, err := conn.Write(mqttConnectPacket); err != nil {
+		return result
+	}
+	connack := make([]byte, 4)
+	if _, err := io.ReadFull(conn, connack); err != nil || connack[0] != 0x20 || connack[1] != 0x02 {
+		return result
+	}
+	// Disconnect politely, so the broker does not log an error.
+	_, _ = conn.Write([]byte{0xe0, 0x00})
+
+	result.Protocol = "mqtt"
+	description, known := mqttConnackCodes[connack[3]]
+	if !known {
+		description = "unknown"
+	}
+	result.Banner = fmt.Sprintf("CONNACK %d (%s)", connack[3], description)
+	return result
+}
+
+// probeRtsp sends an RTSP OPTIONS request and records the Server header, or the supported methods
+// if the server does not name itself.
+func probeRtsp(conn net.Conn, host string, port int, result model.PortBanner) model.PortBanner {
+	request := fmt.Sprintf("OPTIONS rtsp://%s/ RTSP/1.0\r\nCSeq: 1\r\nUser-Agent: idiot\r\n\r\n", net.JoinHostPort(host, strconv.Itoa(port)))
+	if _, err := io.WriteString(conn, request); err != nil {
+		return result
+	}
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	statusLine, err := reader.ReadLine()
+	if err != nil || !strings.HasPrefix(statusLine, "RTSP/") {
+		return result
+	}
+	header, _ := reader.ReadMIMEHeader()
+
+	result.Protocol = "rtsp"
+	result.Banner = cleanBanner([]byte(header.Get("Server")))
+	if result.Banner == "" {
+		result.Banner = cleanBanner([]byte(header.Get("Public")))
+	}
+	return result
+}
+
+// tlsClient wraps a connection in TLS. The certificate is not verified, as the aim is only to
+// identify the service and IoT devices almost always use self-signed certificates.
+func tlsClient(conn net.Conn, host string) net.Conn {
+	return tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: true})
+}
+
+// cleanBanner keeps the first line of a banner, replaces unprintable characters and truncates it.
+func cleanBanner(data []byte) string {
+	text := strings.TrimSpace(string(data))
+	if line, _, found := strings.Cut(text, "\n"); found && !looksLikeLoginPrompt(data) {
+		text = line
+	}
+	text = strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, strings.ToValidUTF8(text, " "))
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > maxBannerLength {
+		text = string(runes[:maxBannerLength])
+	}
+	return text
+}
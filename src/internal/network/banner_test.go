@@ -0,0 +1,40 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// TestGrabBanner verifies that services which speak first and HTTP servers are both identified.
+func TestGrabBanner(t *testing.T) {
+	sshPort := listen(t, "SSH-2.0-dropbear_2019.78\r\n").Addr().(*net.TCPAddr).Port
+	telnetPort := listen(t, "\xff\xfd\x18\xff\xfb\x01BusyBox v1.24.1 built-in shell\r\ncamera login: ").Addr().(*net.TCPAddr).Port
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "lighttpd/1.4.35")
+		fmt.Fprint(w, "<html><head><title>Router Login</title></head></html>")
+	}))
+	defer server.Close()
+	httpPort := server.Listener.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		port     int
+		protocol string
+		banner   string
+		title    string
+	}{
+		{sshPort, "ssh", "SSH-2.0-dropbear_2019.78", ""},
+		{telnetPort, "telnet", "BusyBox v1.24.1 built-in shell camera login:", ""},
+		{httpPort, "http", "lighttpd/1.4.35", "Router Login"},
+	}
+	for _, tt := range tests {
+		got := grabBanner("127.0.0.1", tt.port, 200*time.Millisecond)
+		if got.Protocol != tt.protocol || got.Banner != tt.banner || got.Title != tt.title {
+			t.Errorf("unexpected banner for %s.\ngot:  %+v\nwant: protocol=%q banner=%q title=%q", tt.protocol, got, tt.protocol, tt.banner, tt.title)
+		}
+	}
+}
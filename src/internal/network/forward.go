@@ -0,0 +1,294 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// The kinds of port forwarding, named after the OpenSSH flags that request them.
+const (
+	ForwardLocal   = 'L'
+	ForwardRemote  = 'R'
+	ForwardDynamic = 'D'
+)
+
+// defaultBindHost is the address a forward listens on when none is given, so that forwarded
+// ports are only reachable from the machine they are opened on.
+const defaultBindHost = "127.0.0.1"
+
+// targetDialTimeout limits how long a remote forward waits to connect to its target on this machine,
+// so an unreachable target does not hold the forwarded channel open.
+const targetDialTimeout = 10 * time.Second
+
+// Forward is a single port forwarding rule. For a local forward, connections to Listen on this
+// machine are sent through the device to Target. For a remote forward, connections to Listen on
+// the device are sent back to Target from this machine. A dynamic forward runs a SOCKS5 proxy on
+// Listen, sending each connection through the device to the address the client asks for.
+type Forward struct {
+	Kind   rune
+	Listen string
+	Target string
+}
+
+// String describes the forward in the same form as it is given on the command line.
+func (f Forward) String() string {
+	if f.Kind == ForwardDynamic {
+		return fmt.Sprintf("-%c %s (SOCKS5)", f.Kind, f.Listen)
+	}
+	return fmt.Sprintf("-%c %s -> %s", f.Kind, f.Listen, f.Target)
+}
+
+// ForwardClient is the part of an *ssh.Client used to forward connections.
+type ForwardClient interface {
+	Dial(network, addr string) (net.Conn, error)
+	Listen(network, addr string) (net.Listener, error)
+}
+
+// ParseForward parses a forwarding rule in the OpenSSH format. Local and remote forwards are
+// "[bind_address:]port:host:hostport" and dynamic forwards are "[bind_address:]port". IPv6
+// addresses are written in square brackets. The bind address defaults to 127.0.0.1, and an
+// empty bind address or "*" listens on every interface.
+func ParseForward(kind rune, spec string) (Forward, error) {
+	fields, err := splitForwardSpec(spec)
+	if err != nil {
+		return Forward{}, err
+	}
+
+	forward := Forward{Kind: kind}
+	var listenFields []string
+	switch kind {
+	case ForwardLocal, ForwardRemote:
+		if len(fields) != 3 && len(fields) != 4 {
+			return Forward{}, fmt.Errorf("invalid forward '%s', expected [bind_address:]port:host:hostport", spec)
+		}
+		n := len(fields)
+		if err := checkPort(fields[n-1]); err != nil {
+			return Forward{}, fmt.Errorf("invalid forward '%s': %w", spec, err)
+		}
+		forward.Target = net.JoinHostPort(fields[n-2], fields[n-1])
+		listenFields = fields[:n-2]
+	case ForwardDynamic:
+		if len(fields) != 1 && len(fields) != 2 {
+			return Forward{}, fmt.Errorf("invalid forward '%s', expected [bind_address:]port", spec)
+		}
+		listenFields = fields
+	default:
+		return Forward{}, fmt.Errorf("unknown forward kind '%c'", kind)
+	}
+
+	bindHost, port := defaultBindHost, listenFields[len(listenFields)-1]
+	if len(listenFields) == 2 {
+		// As with OpenSSH, an empty bind address or "*" listens on every interface.
+		bindHost = listenFields[0]
+		if bindHost == "*" {
+			bindHost = ""
+		}
+		// The SSH server is sent the listen address as an IP, which must be given explicitly.
+		if bindHost == "" && kind == ForwardRemote {
+			bindHost = "0.0.0.0"
+		}
+	}
+	if err := checkPort(port); err != nil {
+		return Forward{}, fmt.Errorf("invalid forward '%s': %w", spec, err)
+	}
+	forward.Listen = net.JoinHostPort(bindHost, port)
+	return forward, nil
+}
+
+// splitForwardSpec splits a forwarding rule on colons, keeping bracketed IPv6 addresses whole.
+func splitForwardSpec(spec string) ([]string, error) {
+	var fields []string
+	for len(spec) > 0 {
+		if strings.HasPrefix(spec, "[") {
+			end := strings.Index(spec, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid forward '%s', missing ']'", spec)
+			}
+			fields = append(fields, spec[1:end])
+			spec = strings.TrimPrefix(spec[end+1:], ":")
+			continue
+		}
+		field, rest, found := strings.Cut(spec, ":")
+		fields = append(fields, field)
+		spec = rest
+		if found && rest == "" {
+			fields = append(fields, "")
+		}
+	}
+	return fields, nil
+}
+
+// checkPort returns an error if the port is not a number from 0 to 65535.
+func checkPort(port string) error {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid port '%s'", port)
+	}
+	return nil
+}
+
+// RunForwards opens every forward through the client, and handles connections to them concurrently
+// until the context is cancelled. All of the listeners and open connections are then closed. If any
+// forward cannot be opened, the others are closed and the error is returned.
+func RunForwards(ctx context.Context, client ForwardClient, forwards []Forward) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tracker := &connTracker{conns: make(map[io.Closer]struct{})}
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, listener := range listeners {
+			_ = listener.Close()
+		}
+		tracker.closeAll()
+	}
+
+	for _, forward := range forwards {
+		var listener net.Listener
+		var err error
+		if forward.Kind == ForwardRemote {
+			listener, err = client.Listen("tcp", forward.Listen)
+		} else {
+			listener, err = net.Listen("tcp", forward.Listen)
+		}
+		if err != nil {
+			closeAll()
+			return fmt.Errorf("failed to open forward %s: %w", forward, err)
+		}
+		listeners = append(listeners, listener)
+		log.Info().Msgf("Forwarding %s", forward)
+	}
+
+	var wg sync.WaitGroup
+	for i, listener := range listeners {
+		wg.Add(1)
+		go func(forward Forward, listener net.Listener) {
+			defer wg.Done()
+			acceptForward(ctx, client, forward, listener, tracker)
+		}(forwards[i], listener)
+	}
+
+	<-ctx.Done()
+	closeAll()
+	wg.Wait()
+	return nil
+}
+
+// acceptForward handles each connection made to the forward's listener in its own goroutine,
+// until the listener is closed.
+func acceptForward(ctx context.Context, client ForwardClient, forward Forward, listener net.Listener, tracker *connTracker) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, net.ErrClosed) {
+				log.Error().Msgf("Forward %s stopped accepting connections: %v", forward, err)
+			}
+			return
+		}
+		if !tracker.add(conn) {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer tracker.remove(conn)
+			handleForwardConn(client, forward, conn, tracker)
+		}()
+	}
+}
+
+// handleForwardConn connects an accepted connection to the forward's target and copies data both ways.
+func handleForwardConn(client ForwardClient, forward Forward, conn net.Conn, tracker *connTracker) {
+	target := forward.Target
+	var err error
+	var upstream net.Conn
+	switch forward.Kind {
+	case ForwardLocal:
+		upstream, err = client.Dial("tcp", target)
+	case ForwardRemote:
+		upstream, err = net.DialTimeout("tcp", target, targetDialTimeout)
+	case ForwardDynamic:
+		upstream, target, err = socksConnect(conn, client.Dial)
+	}
+	if err != nil {
+		log.Debug().Msgf("Forward %s failed to connect to %s: %v", forward, target, err)
+		return
+	}
+	if !tracker.add(upstream) {
+		return
+	}
+	defer tracker.remove(upstream)
+
+	log.Debug().Msgf("Forward %s connected %s to %s", forward, conn.RemoteAddr(), target)
+	pipe(conn, upstream)
+}
+
+// pipe copies data between two connections in both directions until both are finished. When one
+// side stops sending, the other side is told with a half close, so request and response protocols
+// still get their response.
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	copyHalf := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, _ = io.Copy(dst, src)
+		if halfCloser, ok := dst.(interface{ CloseWrite() error }); ok {
+			_ = halfCloser.CloseWrite()
+		} else {
+			_ = dst.Close()
+		}
+	}
+	wg.Add(2)
+	go copyHalf(a, b)
+	go copyHalf(b, a)
+	wg.Wait()
+	_ = a.Close()
+	_ = b.Close()
+}
+
+// connTracker keeps the open connections, so they can all be closed when forwarding stops.
+type connTracker struct {
+	mu     sync.Mutex
+	conns  map[io.Closer]struct{}
+	closed bool
+}
+
+// add records a connection. It closes the connection and returns false if forwarding has stopped.
+func (t *connTracker) add(conn io.Closer) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		_ = conn.Close()
+		return false
+	}
+	t.conns[conn] = struct{}{}
+	return true
+}
+
+// remove closes a connection and stops tracking it.
+func (t *connTracker) remove(conn io.Closer) {
+	t.mu.Lock()
+	delete(t.conns, conn)
+	t.mu.Unlock()
+	_ = conn.Close()
+}
+
+// closeAll closes every open connection, and any that are added later.
+func (t *connTracker) closeAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	for conn := range t.conns {
+		_ = conn.Close()
+	}
+}
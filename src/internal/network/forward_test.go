@@ -0,0 +1,166 @@
+package network
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestParseForward verifies the OpenSSH forwarding rule formats.
+func TestParseForward(t *testing.T) {
+	tests := []struct {
+		kind    rune
+		spec    string
+		want    Forward
+		wantErr bool
+	}{
+		{kind: ForwardLocal, spec: "8080:localhost:80", want: Forward{Kind: 'L', Listen: "127.0.0.1:8080", Target: "localhost:80"}},
+		{kind: ForwardLocal, spec: "0.0.0.0:8080:192.168.1.20:80", want: Forward{Kind: 'L', Listen: "0.0.0.0:8080", Target: "192.168.1.20:80"}},
+		{kind: ForwardLocal, spec: "*:8080:localhost:80", want: Forward{Kind: 'L', Listen: ":8080", Target: "localhost:80"}},
+		{kind: ForwardRemote, spec: "*:8080:localhost:80", want: Forward{Kind: 'R', Listen: "0.0.0.0:8080", Target: "localhost:80"}},
+		{kind: ForwardRemote, spec: ":8080:localhost:80", want: Forward{Kind: 'R', Listen: "0.0.0.0:8080", Target: "localhost:80"}},
+		{kind: ForwardRemote, spec: "9000:[::1]:9000", want: Forward{Kind: 'R', Listen: "127.0.0.1:9000", Target: "[::1]:9000"}},
+		{kind: ForwardDynamic, spec: "1080", want: Forward{Kind: 'D', Listen: "127.0.0.1:1080"}},
+		{kind: ForwardDynamic, spec: "[::1]:1080", want: Forward{Kind: 'D', Listen: "[::1]:1080"}},
+		{kind: ForwardLocal, spec: "8080:localhost", wantErr: true},
+		{kind: ForwardLocal, spec: "8080:localhost:http", wantErr: true},
+		{kind: ForwardDynamic, spec: "70000", wantErr: true},
+		{kind: ForwardDynamic, spec: "[::1:1080", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseForward(tt.kind, tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseForward(%c, %q) error = %v, wantErr %v", tt.kind, tt.spec, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseForward(%c, %q) = %+v, want %+v", tt.kind, tt.spec, got, tt.want)
+		}
+	}
+}
+
+// directClient stands in for an SSH client by dialling and listening on this machine.
+type directClient struct{}
+
+func (directClient) Dial(network, addr string) (net.Conn, error) { return net.Dial(network, addr) }
+func (directClient) Listen(network, addr string) (net.Listener, error) {
+	return net.Listen(network, addr)
+}
+
+// startEchoServer returns the address of a server that echoes back each line it receives.
+func startEchoServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+// freeAddr returns a local address with a port that is not in use.
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+// dialForward connects to a forward, retrying while its listener starts.
+func dialForward(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	for attempt := 0; attempt < 50; attempt++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			return conn
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("failed to connect to forward %s", addr)
+	return nil
+}
+
+// echo sends a line on the connection and returns the line sent back.
+func echo(t *testing.T, conn net.Conn, reader *bufio.Reader) string {
+	t.Helper()
+	if _, err := conn.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	return line
+}
+
+// TestRunForwards verifies that local and SOCKS5 forwards reach their target, and that
+// cancelling the context closes open connections.
+func TestRunForwards(t *testing.T) {
+	target := startEchoServer(t)
+	_, targetPort, _ := net.SplitHostPort(target)
+	local := Forward{Kind: ForwardLocal, Listen: freeAddr(t), Target: target}
+	dynamic := Forward{Kind: ForwardDynamic, Listen: freeAddr(t)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- RunForwards(ctx, directClient{}, []Forward{local, dynamic}) }()
+
+	localConn := dialForward(t, local.Listen)
+	defer localConn.Close()
+	if got := echo(t, localConn, bufio.NewReader(localConn)); got != "hello\n" {
+		t.Errorf("local forward echoed %q", got)
+	}
+
+	socksConn := dialForward(t, dynamic.Listen)
+	defer socksConn.Close()
+	portNumber, _ := strconv.Atoi(targetPort)
+	port := binary.BigEndian.AppendUint16(nil, uint16(portNumber))
+	request := append([]byte{5, 1, 0, 5, 1, 0, 3, 9}, "localhost"...)
+	if _, err := socksConn.Write(append(request, port...)); err != nil {
+		t.Fatalf("failed to write SOCKS request: %v", err)
+	}
+	reader := bufio.NewReader(socksConn)
+	reply := make([]byte, 12)
+	if _, err := io.ReadFull(reader, reply); err != nil {
+		t.Fatalf("failed to read SOCKS reply: %v", err)
+	}
+	if reply[0] != 5 || reply[1] != 0 || reply[3] != 0 {
+		t.Fatalf("unexpected SOCKS reply %v", reply)
+	}
+	if got := echo(t, socksConn, reader); got != "hello\n" {
+		t.Errorf("SOCKS forward echoed %q", got)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("RunForwards() failed with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("RunForwards() did not stop after the context was cancelled")
+	}
+	_ = localConn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := localConn.Read(make([]byte, 1)); err == nil {
+		t.Errorf("open connection was not closed")
+	}
+}
@@ -0,0 +1,70 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// errHostKeyFetched ends the SSH handshake once the server has shown its host key, before any authentication.
+var errHostKeyFetched = errors.New("host key fetched")
+
+// PerformHostKeyScan records the SHA256 fingerprint of the SSH host key of every device with an SSH
+// server. The key stays the same when a device's address changes, so it identifies the device. Only
+// the handshake is performed, so no login is attempted. At most opts.Concurrency handshakes run at
+// once, each limited by opts.Timeout.
+func PerformHostKeyScan(discoveredDevices map[string]*model.Device, mu *sync.Mutex, opts PortScanOptions) {
+	semaphore := make(chan struct{}, max(opts.Concurrency, 1))
+	var wg sync.WaitGroup
+	for _, device := range discoveredDevices {
+		if !device.CanConnectSSH || device.SSHPort == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(device *model.Device) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			hostKey, err := fetchHostKey(device.AddrV4, device.SSHPort, opts.Timeout)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			device.HostKey = ssh.FingerprintSHA256(hostKey)
+			mu.Unlock()
+		}(device)
+	}
+	wg.Wait()
+}
+
+// fetchHostKey starts an SSH handshake with the server and returns its host key.
+func fetchHostKey(host string, port int, timeout time.Duration) (ssh.PublicKey, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(3 * timeout))
+
+	var hostKey ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User: "idiot",
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return errHostKeyFetched
+		},
+	}
+	_, _, _, err = ssh.NewClientConn(conn, addr, config)
+	if hostKey != nil {
+		return hostKey, nil
+	}
+	return nil, err
+}
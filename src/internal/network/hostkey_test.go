@@ -0,0 +1,61 @@
+package network
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// TestPerformHostKeyScan verifies that the host key fingerprint of an SSH server is recorded without logging in.
+func TestPerformHostKeyScan(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				// The client ends the handshake once it has seen the host key, so this always fails.
+				_, _, _, _ = ssh.NewServerConn(conn, config)
+			}()
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	devices := map[string]*model.Device{
+		"127.0.0.1": {AddrV4: "127.0.0.1", CanConnectSSH: true, SSHPort: port},
+		"127.0.0.2": {AddrV4: "127.0.0.2"},
+	}
+	PerformHostKeyScan(devices, &sync.Mutex{}, PortScanOptions{Concurrency: 2, Timeout: time.Second})
+
+	if got, want := devices["127.0.0.1"].HostKey, ssh.FingerprintSHA256(signer.PublicKey()); got != want {
+		t.Errorf("HostKey = %q, want %q", got, want)
+	}
+	if got := devices["127.0.0.2"].HostKey; got != "" {
+		t.Errorf("HostKey of a device without SSH = %q, want none", got)
+	}
+}
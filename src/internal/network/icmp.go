@@ -15,41 +15,35 @@ import (
 	"com.bradleytenuta/idiot/internal/model"
 )
 
-// PerformIcmpScan discovers hosts on the local network by sending ICMP echo requests.
+// icmpPayload starts the data of every echo request. It is followed by the time the request was sent,
+// which the reply echoes back, so the round trip time can be measured without tracking each request.
+const icmpPayload = "IDIOT-SCAN"
+
+// PerformIcmpScan discovers hosts on the local network by sending ICMP echo requests to the given IPs.
 // It uses a single listener and concurrent routines for sending pings and reading replies,
 // which is significantly more performant than creating a listener for each ping.
-func PerformIcmpScan(networkAddr, broadcastAddr net.IP, discoveredDevices map[string]*model.Device, mu *sync.Mutex) {
+// The round trip time of each reply is recorded on the device. An error is returned if the listener could not be opened.
+func PerformIcmpScan(ips []net.IP, discoveredDevices map[string]*model.Device, mu *sync.Mutex) error {
 	// Listen for ICMP packets on all available IPv4 interfaces.
 	// We create one listener for the entire scan duration for efficiency.
 	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
 	if err != nil {
 		log.Error().Msgf("Failed to listen for ICMP packets: %v", err)
-		return
+		return err
 	}
 	defer conn.Close()
 
-	// Use a context to manage the scan's lifecycle, ensuring it stops after a timeout.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	var wg sync.WaitGroup
-
-	// Start a dedicated goroutine to read all incoming ICMP replies.
-	wg.Add(1)
-	go readReplies(ctx, conn, discoveredDevices, mu, &wg)
-
-	// Start a dedicated goroutine to send out all the pings.
-	wg.Add(1)
-	go sendPings(conn, networkAddr, broadcastAddr, &wg)
-
-	// Wait for both the sender and reader goroutines to complete.
-	wg.Wait()
+	// Read the replies in a dedicated goroutine while the pings are sent, until the last ping has had time to be answered.
+	sendThenListen(
+		func() { sendPings(conn, ips) },
+		func(ctx context.Context) { readReplies(ctx, conn, discoveredDevices, mu) },
+	)
+	return nil
 }
 
 // readReplies runs in a dedicated goroutine, listening for ICMP echo replies
 // until the context is cancelled.
-func readReplies(ctx context.Context, conn *icmp.PacketConn, discoveredDevices map[string]*model.Device, mu *sync.Mutex, wg *sync.WaitGroup) {
-	defer wg.Done()
+func readReplies(ctx context.Context, conn *icmp.PacketConn, discoveredDevices map[string]*model.Device, mu *sync.Mutex) {
 	replyBuf := make([]byte, 1500)
 
 	for {
@@ -77,41 +71,60 @@ func readReplies(ctx context.Context, conn *icmp.PacketConn, discoveredDevices m
 
 			if msg.Type == ipv4.ICMPTypeEchoReply {
 				if ipAddr, ok := addr.(*net.IPAddr); ok {
-					updateDiscoveredDevice(ipAddr.IP, discoveredDevices, mu)
+					var rtt time.Duration
+					if echo, ok := msg.Body.(*icmp.Echo); ok {
+						rtt = echoRTT(echo.Data, time.Now())
+					}
+					updateDiscoveredDevice(ipAddr.IP, rtt, discoveredDevices, mu)
 				}
 			}
 		}
 	}
 }
 
-// sendPings generates all IPs in the subnet and sends an ICMP echo request to each.
-func sendPings(conn *icmp.PacketConn, networkAddr, broadcastAddr net.IP, wg *sync.WaitGroup) {
-	defer wg.Done()
-
-	// Construct the ICMP Echo Request message once.
-	msg := icmp.Message{
-		Type: ipv4.ICMPTypeEcho, Code: 0,
-		Body: &icmp.Echo{
-			ID:   os.Getpid() & 0xffff, // Use process ID to uniquely identify this pinger.
-			Seq:  1,
-			Data: []byte("IDIOT-SCAN"),
-		},
-	}
-	msgBytes, err := msg.Marshal(nil)
-	if err != nil {
-		log.Error().Msgf("Failed to marshal ICMP message: %v", err)
-		return
+// sendPings sends an ICMP echo request to each of the given IPs.
+func sendPings(conn *icmp.PacketConn, ips []net.IP) {
+	// Iterate through all the target IPs and send a ping, stamped with the time it was sent.
+	for _, ip := range ips {
+		msg := icmp.Message{
+			Type: ipv4.ICMPTypeEcho, Code: 0,
+			Body: &icmp.Echo{
+				ID:   os.Getpid() & 0xffff, // Use process ID to uniquely identify this pinger.
+				Seq:  1,
+				Data: echoData(time.Now()),
+			},
+		}
+		msgBytes, err := msg.Marshal(nil)
+		if err != nil {
+			log.Error().Msgf("Failed to marshal ICMP message: %v", err)
+			return
+		}
+		conn.WriteTo(msgBytes, &net.IPAddr{IP: ip})
+		time.Sleep(sendInterval) // Small delay to avoid flooding the network.
 	}
+}
 
-	// Iterate through all valid host IPs in the subnet and send a ping.
-	for _, ip := range generateIPs(networkAddr, broadcastAddr) {
-		conn.WriteTo(msgBytes, &net.IPAddr{IP: ip})
-		time.Sleep(1 * time.Millisecond) // Small delay to avoid flooding the network.
+// echoData returns the data of an echo request sent at the given time.
+func echoData(sent time.Time) []byte {
+	return binary.BigEndian.AppendUint64([]byte(icmpPayload), uint64(sent.UnixNano()))
+}
+
+// echoRTT returns the round trip time of an echo reply received at the given time, from the time
+// stamped in its data by echoData. It returns 0 if the data was not sent by this scanner.
+func echoRTT(data []byte, received time.Time) time.Duration {
+	if len(data) != len(icmpPayload)+8 || string(data[:len(icmpPayload)]) != icmpPayload {
+		return 0
 	}
+	sent := time.Unix(0, int64(binary.BigEndian.Uint64(data[len(icmpPayload):])))
+	rtt := received.Sub(sent)
+	if rtt < 0 {
+		return 0
+	}
+	return rtt
 }
 
-// updateDiscoveredDevice safely adds or updates a device in the shared map.
-func updateDiscoveredDevice(ip net.IP, discoveredDevices map[string]*model.Device, mu *sync.Mutex) {
+// updateDiscoveredDevice safely adds or updates a device in the shared map, recording the round trip time of its reply when known.
+func updateDiscoveredDevice(ip net.IP, rtt time.Duration, discoveredDevices map[string]*model.Device, mu *sync.Mutex) {
 	mu.Lock()
 	defer mu.Unlock()
 
@@ -120,6 +133,9 @@ func updateDiscoveredDevice(ip net.IP, discoveredDevices map[string]*model.Devic
 		discoveredDevices[ipStr] = &model.Device{AddrV4: ipStr}
 	}
 	discoveredDevices[ipStr].AddSource("ICMP")
+	if rtt > 0 {
+		discoveredDevices[ipStr].IcmpRttMs = float64(rtt.Microseconds()) / 1000
+	}
 }
 
 // generateIPs creates a slice of all valid host IP addresses within a given
@@ -0,0 +1,22 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+// TestEchoRTT verifies that the round trip time is read back from the data of an echo reply.
+func TestEchoRTT(t *testing.T) {
+	sent := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+	data := echoData(sent)
+
+	if got := echoRTT(data, sent.Add(1500*time.Microsecond)); got != 1500*time.Microsecond {
+		t.Errorf("echoRTT() = %s, want 1.5ms", got)
+	}
+	if got := echoRTT([]byte("someone else's ping"), sent); got != 0 {
+		t.Errorf("echoRTT() of foreign data = %s, want 0", got)
+	}
+	if got := echoRTT(data, sent.Add(-time.Second)); got != 0 {
+		t.Errorf("echoRTT() of a reply from the future = %s, want 0", got)
+	}
+}
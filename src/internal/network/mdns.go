@@ -4,61 +4,157 @@ import (
 	"io"
 	stdlog "log"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/hashicorp/mdns"
+	"github.com/miekg/dns"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/net/ipv4"
 
 	"com.bradleytenuta/idiot/internal/model"
 )
 
-// PerformMdnsScan discovers services on the local network using mDNS.
-// It queries for all available services and processes the results concurrently.
-func PerformMdnsScan(iface *net.Interface, discoveredDevices map[string]*model.Device, mu *sync.Mutex) {
-	// A buffered channel is used to receive service entries from the mDNS query.
-	mdnsEntries := make(chan *mdns.ServiceEntry, 100)
+const (
+	// serviceTypeEnumeration is the special DNS-SD name that every responder answers with the service types it offers.
+	serviceTypeEnumeration = "_services._dns-sd._udp.local."
+	// maxConcurrentBrowses limits how many service types are browsed at the same time.
+	maxConcurrentBrowses = 8
+)
+
+// mdnsMulticastAddr is the IPv4 multicast group and port used by mDNS.
+var mdnsMulticastAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// PerformMdnsScan discovers services on the local network using mDNS. It first enumerates every
+// advertised service type (e.g. "_googlecast._tcp", "_hap._tcp") and then browses each type
+// concurrently, recording every service instance on the device that advertised it. Devices outside
+// the target, such as those on another subnet reached by the same interface, are ignored. An error
+// is returned if the service types could not be enumerated.
+func PerformMdnsScan(target *ScanTarget, discoveredDevices map[string]*model.Device, mu *sync.Mutex) error {
+	serviceTypes, err := enumerateServiceTypes(target.Interface, 2*time.Second)
+	if err != nil {
+		log.Debug().Msgf("mDNS service type enumeration error: %v", err)
+		return err
+	}
+	log.Debug().Msgf("mDNS found %d service types: %v", len(serviceTypes), serviceTypes)
+
 	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, maxConcurrentBrowses)
+	for _, serviceType := range serviceTypes {
+		wg.Add(1)
+		go func(serviceType string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			browseServiceType(target, serviceType, discoveredDevices, mu)
+		}(serviceType)
+	}
+	wg.Wait()
+	return nil
+}
 
-	// Goroutine to query for mDNS services.
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		defer close(mdnsEntries)
+// enumerateServiceTypes sends a DNS-SD service type enumeration query and collects the service
+// types named in the PTR answers until the timeout. The query is sent from an ephemeral port, which
+// makes responders reply directly to us rather than to the multicast group (RFC 6762 section 6.7).
+func enumerateServiceTypes(iface *net.Interface, timeout time.Duration) ([]string, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
 
-		// Set up mDNS query parameters. We search for the special "_services._dns-sd._udp" name to discover all available services.
-		params := mdns.DefaultParams("_services._dns-sd._udp")
-		params.Timeout = 2 * time.Second
-		params.Entries = mdnsEntries
-		params.DisableIPv6 = true                     // We get IPv6 from the entry itself if available.
-		params.Logger = stdlog.New(io.Discard, "", 0) // Suppress mdns library's default logger.
+	if iface != nil {
+		if err := ipv4.NewPacketConn(conn).SetMulticastInterface(iface); err != nil {
+			log.Debug().Msgf("Failed to set mDNS multicast interface to %s: %v", iface.Name, err)
+		}
+	}
 
-		if iface != nil {
-			params.Interface = iface
+	query := new(dns.Msg)
+	query.SetQuestion(serviceTypeEnumeration, dns.TypePTR)
+	query.RecursionDesired = false
+	packet, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(packet, mdnsMulticastAddr); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var serviceTypes []string
+	buf := make([]byte, 65536)
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		_ = conn.SetReadDeadline(deadline)
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				break // The enumeration timeout has been reached.
+			}
+			return serviceTypes, err
 		}
 
-		if err := mdns.Query(params); err != nil {
-			log.Debug().Msgf("mDNS query error: %v", err)
+		response := new(dns.Msg)
+		if err := response.Unpack(buf[:n]); err != nil {
+			continue
 		}
-	}()
+		for _, answer := range append(response.Answer, response.Extra...) {
+			ptr, ok := answer.(*dns.PTR)
+			if !ok || !strings.EqualFold(ptr.Hdr.Name, serviceTypeEnumeration) {
+				continue
+			}
+			// "_googlecast._tcp.local." -> "_googlecast._tcp"
+			serviceType := strings.TrimSuffix(strings.TrimSuffix(ptr.Ptr, "."), ".local")
+			if !seen[serviceType] {
+				seen[serviceType] = true
+				serviceTypes = append(serviceTypes, serviceType)
+			}
+		}
+	}
+	return serviceTypes, nil
+}
+
+// browseServiceType queries for every instance of a single service type and processes the
+// results from the target's addresses as they are discovered.
+func browseServiceType(target *ScanTarget, serviceType string, discoveredDevices map[string]*model.Device, mu *sync.Mutex) {
+	// A buffered channel is used to receive service entries from the mDNS query.
+	mdnsEntries := make(chan *mdns.ServiceEntry, 100)
+	var wg sync.WaitGroup
 
 	// Goroutine to process the mDNS entries as they are discovered.
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		for entry := range mdnsEntries {
-			processMdnsEntry(entry, discoveredDevices, mu)
+			if entry.AddrV4 != nil && target.Contains(entry.AddrV4.String()) {
+				processMdnsEntry(serviceType, entry, discoveredDevices, mu)
+			}
 		}
 	}()
 
+	params := mdns.DefaultParams(serviceType)
+	params.Timeout = 2 * time.Second
+	params.Entries = mdnsEntries
+	params.DisableIPv6 = true                     // We get IPv6 from the entry itself if available.
+	params.Logger = stdlog.New(io.Discard, "", 0) // Suppress mdns library's default logger.
+
+	if target.Interface != nil {
+		params.Interface = target.Interface
+	}
+
+	if err := mdns.Query(params); err != nil {
+		log.Debug().Msgf("mDNS query error for %s: %v", serviceType, err)
+	}
+	close(mdnsEntries)
 	wg.Wait()
 }
 
 // processMdnsEntry handles a single discovered mDNS service. It extracts relevant
-// information like IP addresses and hostname, and then safely updates the shared
-// map of discovered devices.
-func processMdnsEntry(entry *mdns.ServiceEntry, discoveredDevices map[string]*model.Device, mu *sync.Mutex) {
+// information like IP addresses, hostname and the service record, and then safely
+// updates the shared map of discovered devices.
+func processMdnsEntry(serviceType string, entry *mdns.ServiceEntry, discoveredDevices map[string]*model.Device, mu *sync.Mutex) {
 	if entry.AddrV4 == nil {
 		return
 	}
@@ -69,6 +165,13 @@ func processMdnsEntry(entry *mdns.ServiceEntry, discoveredDevices map[string]*mo
 	if entry.AddrV6 != nil {
 		addrV6Str = entry.AddrV6.String()
 	}
+	service := model.Service{
+		Instance: extractInstanceName(entry.Name, serviceType),
+		Type:     serviceType,
+		Port:     entry.Port,
+		Target:   unescapeDNSName(strings.TrimSuffix(entry.Host, ".")),
+		TXT:      parseTXTRecord(entry.InfoFields),
+	}
 
 	mu.Lock()
 	defer mu.Unlock()
@@ -88,6 +191,7 @@ func processMdnsEntry(entry *mdns.ServiceEntry, discoveredDevices map[string]*mo
 		device.AddrV6 = addrV6Str
 	}
 
+	device.AddService(service)
 	device.AddSource("mDNS")
 }
 
@@ -101,3 +205,57 @@ func extractModelName(entry *mdns.ServiceEntry) string {
 	}
 	return ""
 }
+
+// extractInstanceName returns the human readable instance name of a service, e.g.
+// "Living\ Room._googlecast._tcp.local." -> "Living Room".
+func extractInstanceName(name, serviceType string) string {
+	name = strings.TrimSuffix(name, ".")
+	name = strings.TrimSuffix(name, ".local")
+	name = strings.TrimSuffix(name, "."+serviceType)
+	return unescapeDNSName(name)
+}
+
+// parseTXTRecord converts DNS-SD TXT strings into a map. A key without '=' is a boolean
+// attribute and is given an empty value (RFC 6763 section 6.4).
+func parseTXTRecord(fields []string) map[string]string {
+	if len(fields) == 0 {
+		return nil
+	}
+	txt := make(map[string]string, len(fields))
+	for _, field := range fields {
+		if field == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(field, "=")
+		// Only the first occurrence of a key is used, as required by RFC 6763.
+		if _, exists := txt[key]; !exists {
+			txt[key] = value
+		}
+	}
+	return txt
+}
+
+// unescapeDNSName reverses the presentation format escaping applied to DNS names,
+// where special characters are written as "\ " and non-ASCII bytes as "\DDD".
+func unescapeDNSName(name string) string {
+	if !strings.Contains(name, "\\") {
+		return name
+	}
+	var builder strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '\\' || i+1 >= len(name) {
+			builder.WriteByte(name[i])
+			continue
+		}
+		if i+3 < len(name) {
+			if value, err := strconv.ParseUint(name[i+1:i+4], 10, 8); err == nil {
+				builder.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		builder.WriteByte(name[i+1])
+		i++
+	}
+	return builder.String()
+}
@@ -0,0 +1,29 @@
+package network
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestExtractInstanceName verifies that instance names are stripped of their service type and unescaped.
+func TestExtractInstanceName(t *testing.T) {
+	tests := map[string]string{
+		`Living\ Room._googlecast._tcp.local.`:   "Living Room",
+		`Caf\195\169\ Speaker._googlecast._tcp.`: "Café Speaker",
+		`plug-1._googlecast._tcp.local.`:         "plug-1",
+	}
+	for name, expected := range tests {
+		if got := extractInstanceName(name, "_googlecast._tcp"); got != expected {
+			t.Errorf("unexpected instance name for %q.\ngot:  %q\nwant: %q", name, got, expected)
+		}
+	}
+}
+
+// TestParseTXTRecord verifies that key/value pairs and boolean attributes are parsed from TXT strings.
+func TestParseTXTRecord(t *testing.T) {
+	got := parseTXTRecord([]string{"md=Google Nest Mini", "fn=Kitchen", "secure", "md=ignored", ""})
+	expected := map[string]string{"md": "Google Nest Mini", "fn": "Kitchen", "secure": ""}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected TXT record.\ngot:  %v\nwant: %v", got, expected)
+	}
+}
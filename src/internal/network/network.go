@@ -1,9 +1,11 @@
 package network
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
@@ -89,3 +91,33 @@ func findInterfaceForIP(ip net.IP) (*net.Interface, *net.IPNet, error) {
 
 	return nil, nil, fmt.Errorf("no interface found for IP %s", ip)
 }
+
+// sendInterval is the pause between the requests sent to each address by the ICMP and ARP scans,
+// so that a large target does not flood the network.
+const sendInterval = time.Millisecond
+
+// replyTimeout is how long the ICMP and ARP scans keep listening for replies after the last request
+// has been sent. It is a variable so that tests can shorten it.
+var replyTimeout = 3 * time.Second
+
+// sendThenListen runs listen in the background while send sends the requests, and stops it once no
+// more replies are expected, replyTimeout after send returns. Timing from the last request rather
+// than the first means every address is given as long to reply, however large the target.
+// listen must return when its context is cancelled, and may return sooner after a fatal error.
+func sendThenListen(send func(), listen func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	listening := make(chan struct{})
+	go func() {
+		defer close(listening)
+		listen(ctx)
+	}()
+
+	send()
+	select {
+	case <-time.After(replyTimeout):
+	case <-listening:
+	}
+	cancel()
+	<-listening
+}
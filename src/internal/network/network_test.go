@@ -0,0 +1,37 @@
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestSendThenListen verifies that replies to the last requests of a target that takes far longer to
+// send than the reply timeout are still read, as with a /16 sent at one request per millisecond.
+func TestSendThenListen(t *testing.T) {
+	defer func(timeout time.Duration) { replyTimeout = timeout }(replyTimeout)
+	replyTimeout = 50 * time.Millisecond
+
+	const requests = 500
+	replies := make(chan int, requests)
+	received := 0
+	sendThenListen(func() {
+		for i := range requests {
+			replies <- i
+			time.Sleep(sendInterval)
+		}
+	}, func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-replies:
+				received++
+			}
+		}
+	})
+
+	if received != requests {
+		t.Errorf("read %d replies, want %d", received, requests)
+	}
+}
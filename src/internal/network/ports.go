@@ -0,0 +1,104 @@
+package network
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// PortScanOptions controls which TCP ports are probed and how aggressively.
+type PortScanOptions struct {
+	Ports       []int
+	Concurrency int
+	Timeout     time.Duration
+}
+
+// sshBannerTimeout is how long an open port is given to send an SSH banner. SSH servers send it as soon
+// as a connection is accepted, so this is kept short, as every open port that is not SSH waits for all of it.
+const sshBannerTimeout = 500 * time.Millisecond
+
+// portProbe is a single device and port pair to check.
+type portProbe struct {
+	device *model.Device
+	port   int
+}
+
+// PerformPortScan checks which of the configured TCP ports are open on the discovered devices.
+// At most opts.Concurrency connections are attempted at once, each limited by opts.Timeout.
+// Open ports are recorded on the device, and any port that greets us with an SSH banner
+// (including SSH on a non-standard port) marks the device as SSH capable.
+func PerformPortScan(discoveredDevices map[string]*model.Device, mu *sync.Mutex, opts PortScanOptions) {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	probes := make(chan portProbe)
+	var wg sync.WaitGroup
+
+	// Start a fixed pool of workers so the number of open sockets stays bounded.
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for probe := range probes {
+				open, isSSH := probePort(probe.device.AddrV4, probe.port, opts.Timeout)
+				if open {
+					recordOpenPort(probe.device, probe.port, isSSH, mu)
+				}
+			}
+		}()
+	}
+
+	for _, device := range discoveredDevices {
+		for _, port := range opts.Ports {
+			probes <- portProbe{device: device, port: port}
+		}
+	}
+	close(probes)
+	wg.Wait()
+
+	// Sort the ports so the output is stable regardless of which probe finished first.
+	for _, device := range discoveredDevices {
+		slices.Sort(device.OpenPorts)
+	}
+}
+
+// probePort attempts a TCP connection to the given port, waiting up to timeout to connect. If it connects,
+// it briefly waits for the server to speak first, as SSH servers always send their version string on connect.
+func probePort(host string, port int, timeout time.Duration) (bool, bool) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		// If there's an error (e.g., connection refused, timeout), the port is not open.
+		return false, false
+	}
+	defer conn.Close()
+
+	// An open port 22 is assumed to be SSH, even if the server is too slow to send its banner.
+	if port == 22 {
+		return true, true
+	}
+	banner := make([]byte, 4)
+	_ = conn.SetReadDeadline(time.Now().Add(min(timeout, sshBannerTimeout)))
+	n, _ := io.ReadFull(conn, banner)
+	return true, bytes.Equal(banner[:n], []byte("SSH-"))
+}
+
+// recordOpenPort safely adds an open port to a device. The SSH port is kept as the standard
+// port 22 when that is open, otherwise the first SSH port found is used.
+func recordOpenPort(device *model.Device, port int, isSSH bool, mu *sync.Mutex) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	device.OpenPorts = append(device.OpenPorts, port)
+	if isSSH && (device.SSHPort == 0 || port == 22) {
+		device.SSHPort = port
+	}
+	device.CanConnectSSH = device.SSHPort != 0
+}
@@ -0,0 +1,102 @@
+package network
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// TestPerformPortScan verifies that open ports are recorded and that SSH is detected on a non-standard port.
+func TestPerformPortScan(t *testing.T) {
+	sshListener := listen(t, "SSH-2.0-dropbear_2022.83\r\n")
+	httpListener := listen(t, "")
+	closedListener := listen(t, "")
+	closedPort := closedListener.Addr().(*net.TCPAddr).Port
+	closedListener.Close()
+
+	sshPort := sshListener.Addr().(*net.TCPAddr).Port
+	httpPort := httpListener.Addr().(*net.TCPAddr).Port
+
+	device := &model.Device{AddrV4: "127.0.0.1"}
+	var mu sync.Mutex
+	PerformPortScan(map[string]*model.Device{device.AddrV4: device}, &mu, PortScanOptions{
+		Ports:       []int{sshPort, httpPort, closedPort},
+		Concurrency: 2,
+		Timeout:     200 * time.Millisecond,
+	})
+
+	if len(device.OpenPorts) != 2 {
+		t.Fatalf("unexpected open ports.\ngot:  %v\nwant: [%d %d]", device.OpenPorts, sshPort, httpPort)
+	}
+	if !device.CanConnectSSH || device.SSHPort != sshPort {
+		t.Errorf("expected SSH on port %d, got CanConnectSSH=%v SSHPort=%d", sshPort, device.CanConnectSSH, device.SSHPort)
+	}
+}
+
+// TestPerformPortScanSilentPort verifies that an open port that sends nothing is not held for the whole connect timeout.
+func TestPerformPortScanSilentPort(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	// Accept connections and leave them open without writing anything.
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	device := &model.Device{AddrV4: "127.0.0.1"}
+	var mu sync.Mutex
+	start := time.Now()
+	PerformPortScan(map[string]*model.Device{device.AddrV4: device}, &mu, PortScanOptions{
+		Ports:       []int{port},
+		Concurrency: 1,
+		Timeout:     5 * time.Second,
+	})
+
+	if elapsed := time.Since(start); elapsed >= 5*time.Second {
+		t.Errorf("port scan took %s, want less than the connect timeout", elapsed)
+	}
+	if len(device.OpenPorts) != 1 || device.CanConnectSSH {
+		t.Errorf("expected port %d open without SSH, got OpenPorts=%v CanConnectSSH=%v", port, device.OpenPorts, device.CanConnectSSH)
+	}
+}
+
+// listen starts a local TCP server that writes the given greeting to every connection.
+func listen(t *testing.T, greeting string) net.Listener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if greeting != "" {
+				_, _ = conn.Write([]byte(greeting))
+			}
+			conn.Close()
+		}
+	}()
+	return listener
+}
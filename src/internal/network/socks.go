@@ -0,0 +1,135 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// SOCKS5 protocol values (RFC 1928).
+const (
+	socksVersion         = 5
+	socksNoAuth          = 0x00
+	socksNoAcceptable    = 0xff
+	socksCmdConnect      = 0x01
+	socksAddrIPv4        = 0x01
+	socksAddrDomain      = 0x03
+	socksAddrIPv6        = 0x04
+	socksSucceeded       = 0x00
+	socksHostUnreachable = 0x04
+	socksCmdUnsupported  = 0x07
+	socksAddrUnsupported = 0x08
+)
+
+// socksHandshakeTimeout limits how long a client has to say where it wants to connect.
+const socksHandshakeTimeout = 10 * time.Second
+
+// socksConnect performs the server side of a SOCKS5 handshake without authentication. The
+// CONNECT request is dialled with dial, and the connection and target address are returned.
+// Only CONNECT is supported, as SSH can only forward TCP streams.
+func socksConnect(conn net.Conn, dial func(network, addr string) (net.Conn, error)) (net.Conn, string, error) {
+	_ = conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	// Greeting: version, number of methods, methods.
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, "", err
+	}
+	if header[0] != socksVersion {
+		return nil, "", fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return nil, "", err
+	}
+	if !containsByte(methods, socksNoAuth) {
+		_, _ = conn.Write([]byte{socksVersion, socksNoAcceptable})
+		return nil, "", errors.New("SOCKS client does not support connecting without authentication")
+	}
+	if _, err := conn.Write([]byte{socksVersion, socksNoAuth}); err != nil {
+		return nil, "", err
+	}
+
+	// Request: version, command, reserved, address type, address, port.
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return nil, "", err
+	}
+	if request[1] != socksCmdConnect {
+		writeSocksReply(conn, socksCmdUnsupported)
+		return nil, "", fmt.Errorf("unsupported SOCKS command %d", request[1])
+	}
+	target, err := readSocksAddr(conn, request[3])
+	if err != nil {
+		writeSocksReply(conn, socksAddrUnsupported)
+		return nil, "", err
+	}
+
+	upstream, err := dial("tcp", target)
+	if err != nil {
+		writeSocksReply(conn, socksHostUnreachable)
+		return nil, target, err
+	}
+	if err := writeSocksReply(conn, socksSucceeded); err != nil {
+		_ = upstream.Close()
+		return nil, target, err
+	}
+	return upstream, target, nil
+}
+
+// readSocksAddr reads the destination address and port of a SOCKS5 request.
+func readSocksAddr(r io.Reader, addrType byte) (string, error) {
+	var host string
+	switch addrType {
+	case socksAddrIPv4, socksAddrIPv6:
+		size := net.IPv4len
+		if addrType == socksAddrIPv6 {
+			size = net.IPv6len
+		}
+		ip := make(net.IP, size)
+		if _, err := io.ReadFull(r, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case socksAddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(r, length); err != nil {
+			return "", err
+		}
+		domain := make([]byte, length[0])
+		if _, err := io.ReadFull(r, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		return "", fmt.Errorf("unsupported SOCKS address type %d", addrType)
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(r, port); err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), nil
+}
+
+// writeSocksReply sends a SOCKS5 reply. The bound address is always reported as 0.0.0.0:0,
+// as the real connection is made by the device and clients do not need it.
+func writeSocksReply(w io.Writer, status byte) error {
+	_, err := w.Write([]byte{socksVersion, status, 0, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// containsByte reports whether b is in the slice.
+func containsByte(bytes []byte, b byte) bool {
+	for _, v := range bytes {
+		if v == b {
+			return true
+		}
+	}
+	return false
+}
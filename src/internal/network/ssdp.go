@@ -0,0 +1,190 @@
+package network
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/ipv4"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// ssdpMulticastAddr is the IPv4 multicast group and port used by SSDP.
+var ssdpMulticastAddr = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+// ssdpSearchRequest asks every UPnP device to respond, waiting up to MX seconds before replying.
+const ssdpSearchRequest = "M-SEARCH * HTTP/1.1\r\n" +
+	"HOST: 239.255.255.250:1900\r\n" +
+	"MAN: \"ssdp:discover\"\r\n" +
+	"MX: 2\r\n" +
+	"ST: ssdp:all\r\n" +
+	"\r\n"
+
+// upnpDescription is the subset of a UPnP device description XML document that we record.
+type upnpDescription struct {
+	Device struct {
+		FriendlyName string `xml:"friendlyName"`
+		Manufacturer string `xml:"manufacturer"`
+		ModelName    string `xml:"modelName"`
+		ModelNumber  string `xml:"modelNumber"`
+		SerialNumber string `xml:"serialNumber"`
+	} `xml:"device"`
+}
+
+// PerformSsdpScan discovers UPnP devices such as smart TVs, media renderers and routers by sending
+// an SSDP M-SEARCH. For each responder it fetches the device description XML from the LOCATION
+// header and records the friendly name, manufacturer, model and serial number on the device.
+// Responders outside the target are ignored. An error is returned if the search could not be sent.
+func PerformSsdpScan(target *ScanTarget, discoveredDevices map[string]*model.Device, mu *sync.Mutex) error {
+	locations, err := searchSsdp(target.Interface, 3*time.Second)
+	if err != nil {
+		log.Debug().Msgf("SSDP search error: %v", err)
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for ipStr, location := range locations {
+		if !target.Contains(ipStr) {
+			continue
+		}
+		wg.Add(1)
+		go func(ipStr, location string) {
+			defer wg.Done()
+			upnp, err := fetchUPnPDescription(ipStr, location)
+			if err != nil {
+				log.Debug().Msgf("Failed to fetch UPnP description from %s: %v", location, err)
+			}
+			recordSsdpResponse(ipStr, upnp, discoveredDevices, mu)
+		}(ipStr, location)
+	}
+	wg.Wait()
+	return nil
+}
+
+// searchSsdp sends an M-SEARCH from an ephemeral port and collects the LOCATION of every
+// responder until the timeout. Only one location is kept per responding IP, as devices
+// answer once for each service they offer.
+func searchSsdp(iface *net.Interface, timeout time.Duration) (map[string]string, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if iface != nil {
+		if err := ipv4.NewPacketConn(conn).SetMulticastInterface(iface); err != nil {
+			log.Debug().Msgf("Failed to set SSDP multicast interface to %s: %v", iface.Name, err)
+		}
+	}
+
+	if _, err := conn.WriteToUDP([]byte(ssdpSearchRequest), ssdpMulticastAddr); err != nil {
+		return nil, err
+	}
+
+	locations := make(map[string]string)
+	buf := make([]byte, 8192)
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		_ = conn.SetReadDeadline(deadline)
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				break // The search timeout has been reached.
+			}
+			return locations, err
+		}
+
+		response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		_ = response.Body.Close()
+
+		ipStr := addr.IP.String()
+		if _, exists := locations[ipStr]; !exists {
+			locations[ipStr] = response.Header.Get("Location")
+		}
+	}
+	return locations, nil
+}
+
+// fetchUPnPDescription downloads and parses the device description at the given location.
+// The description is only fetched from the device that responded, so a spoofed LOCATION
+// header cannot make the scanner request an arbitrary host.
+func fetchUPnPDescription(ipStr, location string) (*model.UPnPDevice, error) {
+	if location == "" {
+		return nil, errors.New("response has no LOCATION header")
+	}
+	locationURL, err := url.Parse(location)
+	if err != nil || (locationURL.Scheme != "http" && locationURL.Scheme != "https") {
+		return nil, fmt.Errorf("invalid LOCATION '%s'", location)
+	}
+	if locationURL.Hostname() != ipStr {
+		return nil, fmt.Errorf("LOCATION '%s' does not point at the responder %s", location, ipStr)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	var description upnpDescription
+	// Limit the body size, descriptions are a few kilobytes at most.
+	if err := xml.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&description); err != nil {
+		return nil, err
+	}
+	return &model.UPnPDevice{
+		FriendlyName: strings.TrimSpace(description.Device.FriendlyName),
+		Manufacturer: strings.TrimSpace(description.Device.Manufacturer),
+		ModelName:    strings.TrimSpace(description.Device.ModelName),
+		ModelNumber:  strings.TrimSpace(description.Device.ModelNumber),
+		SerialNumber: strings.TrimSpace(description.Device.SerialNumber),
+	}, nil
+}
+
+// recordSsdpResponse safely adds or updates a device in the shared map with its UPnP description.
+// The description may be nil if it could not be fetched, the device is still recorded as found.
+func recordSsdpResponse(ipStr string, upnp *model.UPnPDevice, discoveredDevices map[string]*model.Device, mu *sync.Mutex) {
+	if net.ParseIP(ipStr).To4() == nil {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	device, exists := discoveredDevices[ipStr]
+	if !exists {
+		device = &model.Device{AddrV4: ipStr}
+		discoveredDevices[ipStr] = device
+	}
+	if upnp != nil {
+		device.UPnP = upnp
+		// Update the hostname only if it is currently empty to avoid overwriting data from other sources.
+		if device.Hostname == "" && upnp.FriendlyName != "" {
+			device.Hostname = upnp.FriendlyName
+		}
+	}
+	device.AddSource("SSDP")
+}
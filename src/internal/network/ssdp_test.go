@@ -0,0 +1,42 @@
+package network
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// TestFetchUPnPDescription verifies that the identity fields are parsed from a device description.
+func TestFetchUPnPDescription(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:MediaRenderer:1</deviceType>
+    <friendlyName>Living Room TV</friendlyName>
+    <manufacturer>Samsung Electronics</manufacturer>
+    <modelName>UE55</modelName>
+    <modelNumber>AU7100</modelNumber>
+    <serialNumber>ABC123</serialNumber>
+  </device>
+</root>`)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	upnp, err := fetchUPnPDescription(serverURL.Hostname(), server.URL+"/description.xml")
+	if err != nil {
+		t.Fatalf("fetchUPnPDescription() failed with %v", err)
+	}
+	if upnp.FriendlyName != "Living Room TV" || upnp.Manufacturer != "Samsung Electronics" ||
+		upnp.ModelName != "UE55" || upnp.ModelNumber != "AU7100" || upnp.SerialNumber != "ABC123" {
+		t.Errorf("unexpected UPnP description: %+v", upnp)
+	}
+
+	// A LOCATION that points anywhere other than the responder must not be fetched.
+	if _, err := fetchUPnPDescription("192.0.2.1", server.URL+"/description.xml"); err == nil {
+		t.Error("expected an error for a LOCATION on another host, got nil")
+	}
+}
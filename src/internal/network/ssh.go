@@ -1,60 +1,133 @@
 package network
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/rs/zerolog/log"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/knownhosts"
-
-	"com.bradleytenuta/idiot/internal/model"
 )
 
-// PerformSSHScan checks if SSH is available on the discovered devices.
-func PerformSSHScan(discoveredDevices map[string]*model.Device) {
-	var sshWg sync.WaitGroup
-	for _, dev := range discoveredDevices {
-		sshWg.Add(1)
-		// Launch a goroutine for each device to check for SSH.
-		go func(d *model.Device) {
-			defer sshWg.Done() // This ensures that the WaitGroup's counter is decremented when the goroutine finishes, regardless of how it exits.
-			// For each device, check if the SSH port is open and update its status.
-			d.CanConnectSSH = checkSSH(d.AddrV4)
-		}(dev) // Pass the current device pointer to the goroutine to avoid closure issues.
-	}
-	sshWg.Wait() // Wait for all SSH checks to complete.
-}
-
 // AddPort ensures that an address string has a port. If the port is missing,
-// it appends the default SSH port "22". It returns an error if the address
-// is malformed in a way other than a missing port.
-func AddPort(addr string) (string, error) {
+// it appends the given port, or the default SSH port "22" when the port is 0.
+// It returns an error if the address is malformed in a way other than a missing port.
+func AddPort(addr string, port int) (string, error) {
 	_, _, err := net.SplitHostPort(addr)
-	if err != nil {
-		if strings.Contains(err.Error(), "missing port") {
-			return net.JoinHostPort(addr, "22"), nil
+	if err == nil {
+		return addr, nil
+	}
+	if strings.Contains(err.Error(), "missing port") {
+		if port == 0 {
+			port = 22
 		}
+		return net.JoinHostPort(addr, strconv.Itoa(port)), nil
 	}
 	return "", err
 }
 
+// ParseUserHost splits a "[user@]host[:port]" address, as used for jump hosts. IPv6 addresses
+// with a port are written in square brackets. The user is empty and the port is 0 when not given.
+func ParseUserHost(spec string) (string, string, int, error) {
+	user, hostPort := "", spec
+	if at := strings.LastIndex(spec, "@"); at >= 0 {
+		user, hostPort = spec[:at], spec[at+1:]
+	}
+
+	// There is a port when a colon follows the host, after the closing bracket of an IPv6 address.
+	if !strings.Contains(hostPort[strings.LastIndex(hostPort, "]")+1:], ":") {
+		if strings.HasPrefix(hostPort, "[") != strings.HasSuffix(hostPort, "]") {
+			return "", "", 0, fmt.Errorf("invalid address '%s', unmatched brackets", spec)
+		}
+		return user, strings.Trim(hostPort, "[]"), 0, nil
+	}
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid address '%s': %w", spec, err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", "", 0, fmt.Errorf("invalid port in address '%s'", spec)
+	}
+	if host == "" {
+		return "", "", 0, fmt.Errorf("invalid address '%s', missing host", spec)
+	}
+	return user, host, port, nil
+}
+
+// KeepAlive sends a keepalive request to the server every interval, like OpenSSH's ServerAliveInterval,
+// and closes the client once countMax requests in a row go unanswered, so a connection to a device
+// that has gone away is noticed rather than hanging. It returns when the connection is closed.
+func KeepAlive(client *ssh.Client, interval time.Duration, countMax int) {
+	closed := make(chan struct{})
+	go func() {
+		_ = client.Wait()
+		close(closed)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	missed := 0
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+
+		replied := make(chan error, 1)
+		go func() {
+			_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+			replied <- err
+		}()
+		select {
+		case <-closed:
+			return
+		case err := <-replied:
+			if err != nil {
+				return
+			}
+			missed = 0
+		case <-time.After(interval):
+			missed++
+			if missed >= countMax {
+				log.Error().Msgf("No response from %s after %d keepalives, closing the connection.", client.RemoteAddr(), missed)
+				_ = client.Close()
+				return
+			}
+		}
+	}
+}
+
+// HostKeyConfirmFunc asks the user whether to trust a host key that is not in known_hosts yet.
+type HostKeyConfirmFunc func(hostname, keyType, fingerprint string) (bool, error)
+
+// knownHostsMu serialises appends to known_hosts, as several connections may accept keys at once.
+var knownHostsMu sync.Mutex
+
 // GetHostKeyCallback creates a callback function that verifies server host keys
 // against the user's known_hosts file (e.g., ~/.ssh/known_hosts).
 // This is the recommended secure approach to prevent man-in-the-middle attacks.
-func GetHostKeyCallback() (ssh.HostKeyCallback, error) {
-	home, err := os.UserHomeDir()
+// When a host is not in known_hosts yet, the confirm function is asked whether to
+// trust it on first use, and an accepted key is appended to known_hosts with a hashed
+// hostname. A nil confirm function rejects unknown hosts. A host that presents a
+// different key to the one in known_hosts is always rejected.
+func GetHostKeyCallback(confirm HostKeyConfirmFunc) (ssh.HostKeyCallback, error) {
+	knownHostsPath, err := knownHostsFile()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+		return nil, err
 	}
 
-	knownHostsPath := filepath.Join(home, ".ssh", "known_hosts")
-
-	// knownhosts.New will create the file if it doesn't exist.
 	// It returns a callback that verifies the host key. When you connect to an SSH server, it presents
 	// a unique cryptographic "host key" to identify itself. Your SSH client's job is to verify that
 	// this key is the correct one for the server you think you're connecting to.
@@ -62,18 +135,122 @@ func GetHostKeyCallback() (ssh.HostKeyCallback, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create known_hosts callback from '%s': %w", knownHostsPath, err)
 	}
-	return callback, nil
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if err == nil || !errors.As(err, &keyErr) {
+			return err
+		}
+
+		fingerprint := ssh.FingerprintSHA256(key)
+		if len(keyErr.Want) > 0 {
+			return hostKeyMismatchError(hostname, key, keyErr.Want)
+		}
+
+		if confirm == nil {
+			return fmt.Errorf("host key for %s is not in %s (%s %s)", hostname, knownHostsPath, key.Type(), fingerprint)
+		}
+		accepted, err := confirm(hostname, key.Type(), fingerprint)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			return fmt.Errorf("host key for %s was not accepted", hostname)
+		}
+		if err := appendKnownHost(knownHostsPath, hostname, key); err != nil {
+			return fmt.Errorf("failed to add host key to '%s': %w", knownHostsPath, err)
+		}
+		log.Info().Msgf("Permanently added %s (%s) to the list of known hosts.", hostname, key.Type())
+		return nil
+	}, nil
+}
+
+// GetKnownHostKeyAlgorithms returns the host key algorithms that known_hosts holds keys of for the
+// address. These are passed to the SSH handshake, so a server that offers several key types uses the
+// one we already trust, rather than being reported as a mismatch. It returns nil for unknown hosts.
+func GetKnownHostKeyAlgorithms(addr string) []string {
+	knownHostsPath, err := knownHostsFile()
+	if err != nil {
+		return nil
+	}
+	callback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil
+	}
+
+	// Checking a throwaway key makes knownhosts report every key it holds for the host.
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil
+	}
+	probeKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return nil
+	}
+	var keyErr *knownhosts.KeyError
+	if err := callback(addr, &net.TCPAddr{IP: net.IPv4zero}, probeKey); !errors.As(err, &keyErr) {
+		return nil
+	}
+
+	var algorithms []string
+	for _, known := range keyErr.Want {
+		keyType := known.Key.Type()
+		if keyType == ssh.KeyAlgoRSA {
+			// RSA keys are used with SHA-2 signatures by modern servers.
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+		if !slices.Contains(algorithms, keyType) {
+			algorithms = append(algorithms, keyType)
+		}
+	}
+	return algorithms
+}
+
+// hostKeyMismatchError describes a host key that differs from the one in known_hosts,
+// which could mean someone is intercepting the connection.
+func hostKeyMismatchError(hostname string, key ssh.PublicKey, want []knownhosts.KnownKey) error {
+	var known []string
+	for _, k := range want {
+		known = append(known, fmt.Sprintf("%s %s (%s:%d)", k.Key.Type(), ssh.FingerprintSHA256(k.Key), k.Filename, k.Line))
+	}
+	log.Error().Msg("WARNING: REMOTE HOST IDENTIFICATION HAS CHANGED! Someone could be eavesdropping on you right now (man-in-the-middle attack), or the host key has just been changed.")
+	return fmt.Errorf("host key mismatch for %s: offered %s %s, known_hosts has %s. "+
+		"If the change is expected, remove the old entry from known_hosts and connect again",
+		hostname, key.Type(), ssh.FingerprintSHA256(key), strings.Join(known, ", "))
 }
 
-// checkSSH performs a quick check to see if a TCP connection can be established
-// to port 22 on the given host. It uses a short timeout to avoid long waits.
-func checkSSH(host string) bool {
-	address := net.JoinHostPort(host, "22")
-	conn, err := net.DialTimeout("tcp", address, 1*time.Second)
+// appendKnownHost adds a host key to known_hosts with the hostname hashed, as OpenSSH does with HashKnownHosts.
+func appendKnownHost(knownHostsPath, hostname string, key ssh.PublicKey) error {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	file, err := os.OpenFile(knownHostsPath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	line := knownhosts.Line([]string{knownhosts.HashHostname(knownhosts.Normalize(hostname))}, key)
+	_, err = fmt.Fprintln(file, line)
+	return err
+}
+
+// knownHostsFile returns the path of ~/.ssh/known_hosts, creating an empty file (and the
+// ~/.ssh directory) if it does not exist yet, as knownhosts.New cannot open a missing file.
+func knownHostsFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+
+	knownHostsPath := filepath.Join(home, ".ssh", "known_hosts")
+	if err := os.MkdirAll(filepath.Dir(knownHostsPath), 0o700); err != nil {
+		return "", err
+	}
+	file, err := os.OpenFile(knownHostsPath, os.O_CREATE|os.O_RDONLY, 0o600)
 	if err != nil {
-		// If there's an error (e.g., connection refused, timeout), the port is not open.
-		return false
+		return "", err
 	}
-	_ = conn.Close()
-	return true
+	return knownHostsPath, file.Close()
 }
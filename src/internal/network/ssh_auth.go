@@ -0,0 +1,210 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// The authentication methods that can be listed in the ssh_auth_methods setting, see model.DefaultSshAuthMethods.
+const (
+	AuthAgent               = "agent"
+	AuthPublicKey           = "publickey"
+	AuthKeyboardInteractive = "keyboard-interactive"
+	AuthPassword            = "password"
+)
+
+// defaultIdentityFiles are the private keys tried from ~/.ssh when a device has no identity file, matching OpenSSH.
+var defaultIdentityFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// PromptFunc asks the user for a value. A non-zero mask hides the input, e.g. for passwords.
+type PromptFunc func(label string, mask rune) (string, error)
+
+// GetAuthMethods builds the SSH authentication methods in the given order. The agent is reached via
+// SSH_AUTH_SOCK, and the public keys are read from the identity files, or the default keys in ~/.ssh
+// when there are none. The prompt is only used when a method needs input, such as a key's passphrase.
+// Agent and key file signers are offered together as a single "publickey" method, as the server
+// only lets a client try each method once.
+func GetAuthMethods(order []string, identityFiles []string, prompt PromptFunc) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+	publicKeyAdded := false
+
+	for _, name := range order {
+		switch name {
+		case AuthAgent, AuthPublicKey:
+			if publicKeyAdded {
+				continue
+			}
+			publicKeyAdded = true
+			methods = append(methods, ssh.PublicKeysCallback(signersCallback(order, identityFiles, prompt)))
+		case AuthKeyboardInteractive:
+			methods = append(methods, ssh.KeyboardInteractive(keyboardInteractiveChallenge(prompt)))
+		case AuthPassword:
+			methods = append(methods, ssh.RetryableAuthMethod(ssh.PasswordCallback(func() (string, error) {
+				return prompt("Password", '*')
+			}), 3))
+		default:
+			return nil, fmt.Errorf("unknown SSH authentication method '%s', expected one of: %s", name, strings.Join(model.DefaultSshAuthMethods, ", "))
+		}
+	}
+	return methods, nil
+}
+
+// signersCallback returns a callback that loads the agent and key file signers, in the order
+// they appear in the configured methods, the first time the server accepts public keys.
+func signersCallback(order []string, identityFiles []string, prompt PromptFunc) func() ([]ssh.Signer, error) {
+	return func() ([]ssh.Signer, error) {
+		var signers []ssh.Signer
+		for _, name := range order {
+			switch name {
+			case AuthAgent:
+				signers = append(signers, agentSigners()...)
+			case AuthPublicKey:
+				signers = append(signers, keyFileSigners(identityFiles, prompt)...)
+			}
+		}
+		if len(signers) == 0 {
+			return nil, errors.New("no SSH keys available from the agent or identity files")
+		}
+		return signers, nil
+	}
+}
+
+// sshAgent connects to the running ssh-agent the first time it is needed, returning nil if there is none.
+// The connection is shared by every SSH connection and kept open, as the agent is needed to sign each
+// authentication request after its keys have been listed.
+var sshAgent = sync.OnceValue(func() agent.ExtendedAgent {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		log.Debug().Msg("SSH_AUTH_SOCK is not set, skipping the ssh-agent.")
+		return nil
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		log.Debug().Msgf("Failed to connect to the ssh-agent: %v", err)
+		return nil
+	}
+	return agent.NewClient(conn)
+})
+
+// agentSigners returns the keys held by the running ssh-agent, if there is one.
+func agentSigners() []ssh.Signer {
+	client := sshAgent()
+	if client == nil {
+		return nil
+	}
+	signers, err := client.Signers()
+	if err != nil {
+		log.Debug().Msgf("Failed to get keys from the ssh-agent: %v", err)
+		return nil
+	}
+	return signers
+}
+
+// keyFileSigners loads the identity files, or the default keys in ~/.ssh when there are none.
+// Passphrase protected keys prompt the user for their passphrase.
+func keyFileSigners(identityFiles []string, prompt PromptFunc) []ssh.Signer {
+	paths, err := identityFilePaths(identityFiles)
+	if err != nil {
+		log.Debug().Msgf("Failed to find identity files: %v", err)
+		return nil
+	}
+
+	var signers []ssh.Signer
+	for _, path := range paths {
+		signer, err := loadIdentityFile(path, prompt)
+		if err != nil {
+			// A missing default key is normal, only an explicitly configured one is worth an error.
+			if len(identityFiles) > 0 || !errors.Is(err, os.ErrNotExist) {
+				log.Error().Msgf("Failed to load identity file '%s': %v", path, err)
+			}
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	return signers
+}
+
+// identityFilePaths returns the identity files with "~" expanded, or the default keys in ~/.ssh.
+func identityFilePaths(identityFiles []string) ([]string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	if len(identityFiles) > 0 {
+		paths := make([]string, 0, len(identityFiles))
+		for _, identityFile := range identityFiles {
+			paths = append(paths, expandHome(identityFile, home))
+		}
+		return paths, nil
+	}
+	paths := make([]string, 0, len(defaultIdentityFiles))
+	for _, name := range defaultIdentityFiles {
+		paths = append(paths, filepath.Join(home, ".ssh", name))
+	}
+	return paths, nil
+}
+
+// loadIdentityFile parses a private key, prompting for the passphrase if it is encrypted.
+func loadIdentityFile(path string, prompt PromptFunc) (ssh.Signer, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(pemBytes)
+	var missingErr *ssh.PassphraseMissingError
+	if !errors.As(err, &missingErr) {
+		return signer, err
+	}
+
+	passphrase, err := prompt(fmt.Sprintf("Passphrase for %s", filepath.Base(path)), '*')
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKeyWithPassphrase(pemBytes, []byte(passphrase))
+}
+
+// keyboardInteractiveChallenge answers each question the server asks by prompting the user.
+// Questions the server does not want echoed, such as one-time codes or passwords, are masked.
+func keyboardInteractiveChallenge(prompt PromptFunc) ssh.KeyboardInteractiveChallenge {
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		if instruction != "" {
+			log.Info().Msg(instruction)
+		}
+		answers := make([]string, len(questions))
+		for i, question := range questions {
+			var mask rune
+			if i < len(echos) && !echos[i] {
+				mask = '*'
+			}
+			label := strings.TrimSuffix(strings.TrimSpace(question), ":")
+			answer, err := prompt(label, mask)
+			if err != nil {
+				return nil, err
+			}
+			answers[i] = answer
+		}
+		return answers, nil
+	}
+}
+
+// expandHome replaces a leading "~" in a path with the user's home directory.
+func expandHome(path, home string) string {
+	if path == "~" {
+		return home
+	}
+	if rest, found := strings.CutPrefix(path, "~/"); found {
+		return filepath.Join(home, rest)
+	}
+	return path
+}
@@ -0,0 +1,72 @@
+package network
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// TestLoadIdentityFilePassphrase verifies that the user is prompted for the passphrase of an encrypted key.
+func TestLoadIdentityFilePassphrase(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(privateKey, "", []byte("secret"))
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	prompted := ""
+	signer, err := loadIdentityFile(path, func(label string, mask rune) (string, error) {
+		prompted = label
+		return "secret", nil
+	})
+	if err != nil {
+		t.Fatalf("loadIdentityFile() failed with %v", err)
+	}
+	if prompted != "Passphrase for id_ed25519" {
+		t.Errorf("unexpected prompt.\ngot:  %q\nwant: %q", prompted, "Passphrase for id_ed25519")
+	}
+	if signer.PublicKey().Type() != ssh.KeyAlgoED25519 {
+		t.Errorf("unexpected key type: %s", signer.PublicKey().Type())
+	}
+}
+
+// TestGetAuthMethodsUnknown verifies that a misspelt authentication method is rejected.
+func TestGetAuthMethodsUnknown(t *testing.T) {
+	if _, err := GetAuthMethods([]string{"agent", "pubkey"}, nil, nil); err == nil {
+		t.Error("expected an error for an unknown authentication method, got nil")
+	}
+}
+
+// TestKeyFileSigners verifies that every identity file is tried, so a key later in the list is still offered.
+func TestKeyFileSigners(t *testing.T) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "id_work")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+
+	signers := keyFileSigners([]string{filepath.Join(dir, "id_missing"), path}, nil)
+	if len(signers) != 1 || signers[0].PublicKey().Type() != ssh.KeyAlgoED25519 {
+		t.Errorf("expected the key from the second identity file, got %d signers", len(signers))
+	}
+}
@@ -0,0 +1,372 @@
+package network
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxIncludeDepth stops Include directives that include each other from recursing forever.
+const maxIncludeDepth = 16
+
+// SSHConfig is the user's OpenSSH client configuration, usually ~/.ssh/config. Only the
+// settings idiot can use are kept, and are looked up per host with Lookup.
+type SSHConfig struct {
+	blocks []sshConfigBlock
+}
+
+// sshConfigBlock is the options under one Host or Match line. Options before the first
+// Host or Match line are in a block that matches every host.
+type sshConfigBlock struct {
+	// patterns are the Host patterns, or nil for a Match block.
+	patterns []string
+	// criteria are the Match criteria, or nil for a Host block.
+	criteria []matchCriterion
+	options  []sshConfigOption
+}
+
+// matchCriterion is a single criterion of a Match line, e.g. "host *.local" or "!user root".
+type matchCriterion struct {
+	name     string
+	patterns string
+	negate   bool
+}
+
+// sshConfigOption is a keyword, lower cased, and its arguments.
+type sshConfigOption struct {
+	key  string
+	args []string
+}
+
+// SSHHostConfig holds the settings from the configuration that apply to a host.
+// Fields are empty or zero when the configuration does not set them.
+type SSHHostConfig struct {
+	HostName            string
+	User                string
+	Port                int
+	IdentityFiles       []string
+	ProxyJump           []string
+	ServerAliveInterval time.Duration
+	ServerAliveCountMax int
+}
+
+// LoadSSHConfig reads ~/.ssh/config. A missing file is not an error and gives an empty configuration.
+func LoadSSHConfig() (*SSHConfig, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	sshDir := filepath.Join(home, ".ssh")
+	config := &SSHConfig{}
+	if err := config.parseFile(filepath.Join(sshDir, "config"), sshDir, sshConfigBlock{}, 0); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return config, nil
+		}
+		return nil, err
+	}
+	return config, nil
+}
+
+// ParseSSHConfig parses an OpenSSH client configuration. Relative Include paths are
+// resolved against dir, which is normally ~/.ssh.
+func ParseSSHConfig(r io.Reader, dir string) (*SSHConfig, error) {
+	config := &SSHConfig{}
+	if err := config.parse(r, dir, sshConfigBlock{}, 0); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// parseFile parses a configuration file, starting in the given block.
+func (c *SSHConfig) parseFile(path, dir string, block sshConfigBlock, depth int) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return c.parse(file, dir, block, depth)
+}
+
+// parse reads the configuration line by line, adding a block for each Host and Match line.
+// Options before the first of them are added to the given block.
+func (c *SSHConfig) parse(r io.Reader, dir string, block sshConfigBlock, depth int) error {
+	current := len(c.blocks)
+	c.blocks = append(c.blocks, block)
+
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		key, args, err := parseSSHConfigLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		switch key {
+		case "":
+			continue
+		case "host":
+			current = len(c.blocks)
+			c.blocks = append(c.blocks, sshConfigBlock{patterns: args})
+		case "match":
+			criteria, err := parseMatchCriteria(args)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			current = len(c.blocks)
+			c.blocks = append(c.blocks, sshConfigBlock{criteria: criteria})
+		case "include":
+			// Included options apply under the current Host or Match line. Afterwards, the
+			// rest of this file carries on under that line too.
+			enclosing := sshConfigBlock{patterns: c.blocks[current].patterns, criteria: c.blocks[current].criteria}
+			if err := c.include(args, dir, enclosing, depth); err != nil {
+				return fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			current = len(c.blocks)
+			c.blocks = append(c.blocks, enclosing)
+		default:
+			c.blocks[current].options = append(c.blocks[current].options, sshConfigOption{key: key, args: args})
+		}
+	}
+	return scanner.Err()
+}
+
+// include parses every file matched by the Include patterns.
+func (c *SSHConfig) include(patterns []string, dir string, block sshConfigBlock, depth int) error {
+	if depth >= maxIncludeDepth {
+		return errors.New("too many nested Include directives")
+	}
+	home, _ := os.UserHomeDir()
+	for _, pattern := range patterns {
+		pattern = expandHome(pattern, home)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid Include pattern '%s': %w", pattern, err)
+		}
+		for _, path := range paths {
+			if err := c.parseFile(path, dir, block, depth+1); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// parseSSHConfigLine splits a line into its lower cased keyword and arguments. The keyword may be
+// separated from the arguments by "=", and arguments containing spaces may be double quoted.
+// Blank lines and comments return an empty keyword.
+func parseSSHConfigLine(line string) (string, []string, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", nil, nil
+	}
+	end := strings.IndexAny(line, " \t=")
+	if end < 0 {
+		return strings.ToLower(line), nil, nil
+	}
+	key := strings.ToLower(line[:end])
+	rest := strings.TrimSpace(line[end:])
+	rest = strings.TrimSpace(strings.TrimPrefix(rest, "="))
+
+	var args []string
+	for rest != "" {
+		var arg string
+		if strings.HasPrefix(rest, `"`) {
+			closing := strings.Index(rest[1:], `"`)
+			if closing < 0 {
+				return "", nil, fmt.Errorf("unterminated quote in '%s'", line)
+			}
+			arg, rest = rest[1:closing+1], rest[closing+2:]
+		} else if end := strings.IndexAny(rest, " \t"); end >= 0 {
+			arg, rest = rest[:end], rest[end:]
+		} else {
+			arg, rest = rest, ""
+		}
+		args = append(args, arg)
+		rest = strings.TrimSpace(rest)
+	}
+	return key, args, nil
+}
+
+// parseMatchCriteria parses the arguments of a Match line into criteria. "all" takes no
+// patterns, every other criterion takes a comma separated pattern list.
+func parseMatchCriteria(args []string) ([]matchCriterion, error) {
+	var criteria []matchCriterion
+	for i := 0; i < len(args); i++ {
+		criterion := matchCriterion{name: strings.ToLower(args[i])}
+		if rest, found := strings.CutPrefix(criterion.name, "!"); found {
+			criterion.name, criterion.negate = rest, true
+		}
+		switch criterion.name {
+		case "all", "canonical", "final":
+		default:
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("missing argument for Match criterion '%s'", criterion.name)
+			}
+			i++
+			criterion.patterns = args[i]
+		}
+		criteria = append(criteria, criterion)
+	}
+	return criteria, nil
+}
+
+// Lookup returns the settings that apply to a host known by any of the given names, such as its
+// hostname and IP address, when logging in as the given remote user. As in OpenSSH, the first value
+// found for each setting wins, except IdentityFile which collects every value. A Host line also
+// matches when its HostName is one of the names, so an alias such as "Host pi" with
+// "HostName 192.168.1.20" applies to the saved device at that address.
+func (c *SSHConfig) Lookup(names []string, remoteUser string) SSHHostConfig {
+	var settings SSHHostConfig
+	seen := make(map[string]bool)
+
+	for _, block := range c.blocks {
+		if !block.matches(names, remoteUser) {
+			continue
+		}
+		for _, option := range block.options {
+			if len(option.args) == 0 {
+				continue
+			}
+			if option.key == "identityfile" {
+				settings.IdentityFiles = append(settings.IdentityFiles, option.args[0])
+				continue
+			}
+			if seen[option.key] {
+				continue
+			}
+			seen[option.key] = true
+			applySSHOption(&settings, option, names)
+		}
+	}
+	return settings
+}
+
+// applySSHOption sets the field of the settings that the option controls, ignoring options idiot does not use.
+func applySSHOption(settings *SSHHostConfig, option sshConfigOption, names []string) {
+	value := option.args[0]
+	switch option.key {
+	case "hostname":
+		if len(names) > 0 {
+			value = strings.ReplaceAll(value, "%h", names[0])
+		}
+		settings.HostName = value
+	case "user":
+		settings.User = value
+	case "port":
+		if port, err := strconv.Atoi(value); err == nil {
+			settings.Port = port
+		}
+	case "proxyjump":
+		if !strings.EqualFold(value, "none") {
+			settings.ProxyJump = strings.Split(value, ",")
+		}
+	case "serveraliveinterval":
+		if seconds, err := strconv.Atoi(value); err == nil {
+			settings.ServerAliveInterval = time.Duration(seconds) * time.Second
+		}
+	case "serveralivecountmax":
+		if count, err := strconv.Atoi(value); err == nil {
+			settings.ServerAliveCountMax = count
+		}
+	}
+}
+
+// matches reports whether the block applies to a host with any of the names.
+func (b sshConfigBlock) matches(names []string, remoteUser string) bool {
+	if b.patterns == nil && b.criteria == nil {
+		return true
+	}
+	if b.patterns != nil {
+		if matchPatternList(b.patterns, names) {
+			return true
+		}
+		// Treat the Host as an alias of its HostName, so the block applies to the address it names.
+		for _, option := range b.options {
+			if option.key == "hostname" && len(option.args) > 0 && !strings.Contains(option.args[0], "%") {
+				return matchPatternList([]string{option.args[0]}, names)
+			}
+		}
+		return false
+	}
+
+	for _, criterion := range b.criteria {
+		var matched bool
+		switch criterion.name {
+		case "all":
+			matched = true
+		case "host", "originalhost":
+			matched = matchPatternList(strings.Split(criterion.patterns, ","), names)
+		case "user":
+			matched = matchPatternList(strings.Split(criterion.patterns, ","), []string{remoteUser})
+		case "localuser":
+			localUser := ""
+			if current, err := user.Current(); err == nil {
+				localUser = current.Username
+			}
+			matched = matchPatternList(strings.Split(criterion.patterns, ","), []string{localUser})
+		default:
+			// Criteria such as exec and canonical cannot be evaluated here, so the block is skipped.
+			log.Debug().Msgf("Ignoring ~/.ssh/config Match block with unsupported criterion '%s'.", criterion.name)
+			return false
+		}
+		if matched == criterion.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPatternList reports whether any of the names matches the patterns. A name matching a
+// pattern negated with "!" never matches, as in OpenSSH.
+func matchPatternList(patterns []string, names []string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		negated, isNegated := strings.CutPrefix(pattern, "!")
+		for _, name := range names {
+			if name == "" || !matchWildcard(strings.ToLower(negated), strings.ToLower(name)) {
+				continue
+			}
+			if isNegated {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// matchWildcard matches a name against an OpenSSH pattern, where "*" matches any run of
+// characters and "?" matches exactly one.
+func matchWildcard(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(name); i >= 0; i-- {
+				if matchWildcard(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if name == "" {
+				return false
+			}
+		default:
+			if name == "" || name[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return name == ""
+}
@@ -0,0 +1,150 @@
+package network
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSSHConfig = `
+# Global defaults come first.
+ServerAliveCountMax 5
+
+Host pi
+    HostName 192.168.1.20
+    User pi
+    IdentityFile ~/.ssh/pi_ed25519
+
+Host *.lan !printer.lan
+    User admin
+    Port=2222
+    ProxyJump bastion,jump@10.0.0.1:22
+
+Host "camera-*"
+    User root
+    ServerAliveInterval 15
+
+Match host 10.0.* !user root
+    User operator
+    ProxyJump none
+
+Match exec "test -f /tmp/x"
+    User ignored
+
+Host *
+    User fallback
+    IdentityFile ~/.ssh/id_ed25519
+`
+
+// TestSSHConfigLookup verifies that Host and Match blocks apply in order, with the first value winning.
+func TestSSHConfigLookup(t *testing.T) {
+	config, err := ParseSSHConfig(strings.NewReader(testSSHConfig), t.TempDir())
+	if err != nil {
+		t.Fatalf("ParseSSHConfig() failed with %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		names []string
+		user  string
+		want  SSHHostConfig
+	}{
+		{
+			name:  "alias matched by its HostName",
+			names: []string{"raspberrypi", "192.168.1.20"},
+			want: SSHHostConfig{HostName: "192.168.1.20", User: "pi", ServerAliveCountMax: 5,
+				IdentityFiles: []string{"~/.ssh/pi_ed25519", "~/.ssh/id_ed25519"}},
+		},
+		{
+			name:  "alias matched by name",
+			names: []string{"pi"},
+			want: SSHHostConfig{HostName: "192.168.1.20", User: "pi", ServerAliveCountMax: 5,
+				IdentityFiles: []string{"~/.ssh/pi_ed25519", "~/.ssh/id_ed25519"}},
+		},
+		{
+			name:  "wildcard",
+			names: []string{"Sensor.lan", "192.168.1.30"},
+			want: SSHHostConfig{User: "admin", Port: 2222, ProxyJump: []string{"bastion", "jump@10.0.0.1:22"},
+				ServerAliveCountMax: 5, IdentityFiles: []string{"~/.ssh/id_ed25519"}},
+		},
+		{
+			name:  "negated pattern",
+			names: []string{"printer.lan"},
+			want:  SSHHostConfig{User: "fallback", ServerAliveCountMax: 5, IdentityFiles: []string{"~/.ssh/id_ed25519"}},
+		},
+		{
+			name:  "quoted pattern",
+			names: []string{"camera-1"},
+			want: SSHHostConfig{User: "root", ServerAliveInterval: 15 * time.Second, ServerAliveCountMax: 5,
+				IdentityFiles: []string{"~/.ssh/id_ed25519"}},
+		},
+		{
+			name:  "match host",
+			names: []string{"10.0.3.4"},
+			want:  SSHHostConfig{User: "operator", ServerAliveCountMax: 5, IdentityFiles: []string{"~/.ssh/id_ed25519"}},
+		},
+		{
+			name:  "match negated user",
+			names: []string{"10.0.3.4"},
+			user:  "root",
+			want:  SSHHostConfig{User: "fallback", ServerAliveCountMax: 5, IdentityFiles: []string{"~/.ssh/id_ed25519"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := config.Lookup(tt.names, tt.user)
+			if got.HostName != tt.want.HostName || got.User != tt.want.User || got.Port != tt.want.Port ||
+				got.ServerAliveInterval != tt.want.ServerAliveInterval || got.ServerAliveCountMax != tt.want.ServerAliveCountMax ||
+				!slices.Equal(got.IdentityFiles, tt.want.IdentityFiles) || !slices.Equal(got.ProxyJump, tt.want.ProxyJump) {
+				t.Errorf("Lookup(%v) =\n%+v\nwant\n%+v", tt.names, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSSHConfigInclude verifies that included files apply under the Host line they are included from.
+func TestSSHConfigInclude(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "config.d"), 0o700); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.d", "lab"), []byte("Port 2200\nHost lab-*\n  User lab\n"), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	config, err := ParseSSHConfig(strings.NewReader("Host gateway\n  Include config.d/*\n  User gw\n"), dir)
+	if err != nil {
+		t.Fatalf("ParseSSHConfig() failed with %v", err)
+	}
+	if got := config.Lookup([]string{"gateway"}, ""); got.Port != 2200 || got.User != "gw" {
+		t.Errorf("unexpected settings for gateway: %+v", got)
+	}
+	if got := config.Lookup([]string{"lab-1"}, ""); got.Port != 0 || got.User != "lab" {
+		t.Errorf("unexpected settings for lab-1: %+v", got)
+	}
+}
+
+// TestMatchWildcard verifies the OpenSSH "*" and "?" wildcards.
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*", "anything", true},
+		{"192.168.1.*", "192.168.1.20", true},
+		{"192.168.1.*", "192.168.10.20", false},
+		{"pi-?", "pi-1", true},
+		{"pi-?", "pi-10", false},
+		{"*.local", "printer.local", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+	}
+	for _, tt := range tests {
+		if got := matchWildcard(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchWildcard(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
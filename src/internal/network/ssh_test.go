@@ -0,0 +1,137 @@
+package network
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// newHostKey generates a random ed25519 host key.
+func newHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	publicKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	key, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("failed to convert key: %v", err)
+	}
+	return key
+}
+
+// TestGetHostKeyCallbackTrustOnFirstUse verifies that an accepted host key is saved to known_hosts,
+// hashed, and that a different key for the same host is then rejected.
+func TestGetHostKeyCallbackTrustOnFirstUse(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	remote := &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 22}
+	key := newHostKey(t)
+	prompts := 0
+	confirm := func(hostname, keyType, fingerprint string) (bool, error) {
+		prompts++
+		if fingerprint != ssh.FingerprintSHA256(key) || keyType != ssh.KeyAlgoED25519 {
+			t.Errorf("unexpected key shown: %s %s", keyType, fingerprint)
+		}
+		return true, nil
+	}
+
+	callback, err := GetHostKeyCallback(confirm)
+	if err != nil {
+		t.Fatalf("GetHostKeyCallback() failed with %v", err)
+	}
+	if err := callback("192.168.1.10:22", remote, key); err != nil {
+		t.Fatalf("accepted key was rejected: %v", err)
+	}
+
+	knownHosts, err := os.ReadFile(filepath.Join(home, ".ssh", "known_hosts"))
+	if err != nil {
+		t.Fatalf("failed to read known_hosts: %v", err)
+	}
+	if !strings.HasPrefix(string(knownHosts), "|1|") || strings.Contains(string(knownHosts), "192.168.1.10") {
+		t.Errorf("known_hosts entry is not hashed: %q", knownHosts)
+	}
+
+	// A new callback re-reads known_hosts, so the host is now known and the user is not asked again.
+	callback, err = GetHostKeyCallback(confirm)
+	if err != nil {
+		t.Fatalf("GetHostKeyCallback() failed with %v", err)
+	}
+	if err := callback("192.168.1.10:22", remote, key); err != nil {
+		t.Errorf("known key was rejected: %v", err)
+	}
+	if prompts != 1 {
+		t.Errorf("user was asked %d times, want 1", prompts)
+	}
+	if algorithms := GetKnownHostKeyAlgorithms("192.168.1.10:22"); !slices.Equal(algorithms, []string{ssh.KeyAlgoED25519}) {
+		t.Errorf("unexpected known host key algorithms: %v", algorithms)
+	}
+
+	err = callback("192.168.1.10:22", remote, newHostKey(t))
+	if err == nil || !strings.Contains(err.Error(), "host key mismatch") || !strings.Contains(err.Error(), ssh.FingerprintSHA256(key)) {
+		t.Errorf("changed key was not rejected with the old fingerprint: %v", err)
+	}
+	if prompts != 1 {
+		t.Errorf("user was asked to accept a changed key")
+	}
+}
+
+// TestGetHostKeyCallbackDeclined verifies that a declined host key is rejected and not saved.
+func TestGetHostKeyCallbackDeclined(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	callback, err := GetHostKeyCallback(func(string, string, string) (bool, error) { return false, nil })
+	if err != nil {
+		t.Fatalf("GetHostKeyCallback() failed with %v", err)
+	}
+	remote := &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 22}
+	if err := callback("192.168.1.10:22", remote, newHostKey(t)); err == nil {
+		t.Errorf("declined key was accepted")
+	}
+	if knownHosts, _ := os.ReadFile(filepath.Join(home, ".ssh", "known_hosts")); len(knownHosts) != 0 {
+		t.Errorf("declined key was saved: %q", knownHosts)
+	}
+}
+
+// TestParseUserHost verifies that jump host addresses are split into user, host and port.
+func TestParseUserHost(t *testing.T) {
+	tests := []struct {
+		spec    string
+		user    string
+		host    string
+		port    int
+		wantErr bool
+	}{
+		{spec: "bastion.local", host: "bastion.local"},
+		{spec: "pi@192.168.1.2", user: "pi", host: "192.168.1.2"},
+		{spec: "pi@192.168.1.2:2222", user: "pi", host: "192.168.1.2", port: 2222},
+		{spec: "admin@[fe80::1]:22", user: "admin", host: "fe80::1", port: 22},
+		{spec: "[fe80::1]", host: "fe80::1"},
+		{spec: "pi@host:ssh", wantErr: true},
+		{spec: "pi@:22", wantErr: true},
+		{spec: "fe80::1", wantErr: true},
+		{spec: "[fe80::1", wantErr: true},
+		{spec: "pi@host]", wantErr: true},
+	}
+	for _, tt := range tests {
+		user, host, port, err := ParseUserHost(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseUserHost(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if user != tt.user || host != tt.host || port != tt.port {
+			t.Errorf("ParseUserHost(%q) = %q, %q, %d, want %q, %q, %d", tt.spec, user, host, port, tt.user, tt.host, tt.port)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxTargetHosts caps how many addresses a single scan may probe, so a mistyped CIDR such
+// as 10.0.0.0/8 does not send millions of packets.
+const maxTargetHosts = 65536
+
+// ScanTarget describes what a scan should probe: the IPv4 addresses to sweep and the
+// interface to send multicast and link-layer traffic from.
+type ScanTarget struct {
+	Interface *net.Interface
+	IPs       []net.IP
+	// addrs holds every address of IPs, for Contains.
+	addrs map[string]bool
+}
+
+// Contains reports whether the IPv4 address, such as "192.168.1.20", is one of the target's addresses.
+func (t *ScanTarget) Contains(addr string) bool {
+	return t.addrs[addr]
+}
+
+// ResolveScanTarget builds the scan target from the user's CIDRs, IP ranges and interface name.
+// When no CIDRs or ranges are given, the subnet of the named interface is used. When nothing is
+// given at all, it falls back to the subnet of the internet-facing interface.
+func ResolveScanTarget(cidrs, ranges []string, ifaceName string) (*ScanTarget, error) {
+	target := &ScanTarget{}
+
+	if ifaceName != "" {
+		iface, err := net.InterfaceByName(ifaceName)
+		if err != nil {
+			return nil, fmt.Errorf("could not find interface '%s': %w", ifaceName, err)
+		}
+		target.Interface = iface
+	}
+
+	target.addrs = make(map[string]bool)
+	addIPs := func(ips []net.IP) error {
+		for _, ip := range ips {
+			if key := ip.String(); !target.addrs[key] {
+				target.addrs[key] = true
+				target.IPs = append(target.IPs, ip)
+			}
+		}
+		if len(target.IPs) > maxTargetHosts {
+			return fmt.Errorf("scan target has more than %d addresses, use a smaller CIDR or range", maxTargetHosts)
+		}
+		return nil
+	}
+
+	for _, cidr := range cidrs {
+		ips, err := cidrIPs(cidr)
+		if err != nil {
+			return nil, err
+		}
+		if err := addIPs(ips); err != nil {
+			return nil, err
+		}
+	}
+	for _, ipRange := range ranges {
+		ips, err := rangeIPs(ipRange)
+		if err != nil {
+			return nil, err
+		}
+		if err := addIPs(ips); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case len(target.IPs) > 0 && target.Interface == nil:
+		// Pick the interface that is directly attached to the targets, if there is one, so ARP and mDNS can use it.
+		target.Interface = findInterfaceForSubnet(target.IPs[0])
+	case len(target.IPs) == 0 && target.Interface != nil:
+		ipNet := interfaceIPv4Net(target.Interface)
+		if ipNet == nil {
+			return nil, fmt.Errorf("interface '%s' has no IPv4 address", target.Interface.Name)
+		}
+		if err := addIPs(subnetIPs(ipNet)); err != nil {
+			return nil, err
+		}
+	case len(target.IPs) == 0:
+		networkAddr, broadcastAddr, iface, err := GetInternetFacingNetworkInfo()
+		if err != nil {
+			return nil, err
+		}
+		target.Interface = iface
+		if err := addIPs(generateIPs(networkAddr, broadcastAddr)); err != nil {
+			return nil, err
+		}
+	}
+
+	ifaceDesc := "default"
+	if target.Interface != nil {
+		ifaceDesc = target.Interface.Name
+	}
+	log.Debug().Msgf("Scan target: %d addresses on interface: %s", len(target.IPs), ifaceDesc)
+	return target, nil
+}
+
+// cidrIPs returns the host addresses of an IPv4 CIDR such as "192.168.1.0/24".
+func cidrIPs(cidr string) ([]net.IP, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR '%s': %w", cidr, err)
+	}
+	if ipNet.IP.To4() == nil {
+		return nil, fmt.Errorf("invalid CIDR '%s': only IPv4 is supported", cidr)
+	}
+	if ones, bits := ipNet.Mask.Size(); uint64(1)<<(bits-ones) > maxTargetHosts {
+		return nil, fmt.Errorf("invalid CIDR '%s': more than %d addresses", cidr, maxTargetHosts)
+	}
+	return subnetIPs(ipNet), nil
+}
+
+// subnetIPs returns the host addresses of a subnet. The network and broadcast addresses are
+// excluded, except for /31 and /32 networks where every address is a host.
+func subnetIPs(ipNet *net.IPNet) []net.IP {
+	ones, bits := ipNet.Mask.Size()
+	networkAddr := ipNet.IP.Mask(ipNet.Mask).To4()
+	broadcastAddr := make(net.IP, len(networkAddr))
+	for i := range networkAddr {
+		broadcastAddr[i] = networkAddr[i] | ^ipNet.Mask[len(ipNet.Mask)-len(networkAddr)+i]
+	}
+	if bits-ones <= 1 {
+		return inclusiveIPs(networkAddr, broadcastAddr)
+	}
+	return generateIPs(networkAddr, broadcastAddr)
+}
+
+// rangeIPs returns every address in an inclusive IPv4 range, written either as
+// "192.168.1.10-192.168.1.50" or in the short form "192.168.1.10-50".
+func rangeIPs(ipRange string) ([]net.IP, error) {
+	startStr, endStr, found := strings.Cut(ipRange, "-")
+	if !found {
+		return nil, fmt.Errorf("invalid range '%s': expected <start>-<end>", ipRange)
+	}
+	start := net.ParseIP(strings.TrimSpace(startStr)).To4()
+	if start == nil {
+		return nil, fmt.Errorf("invalid range '%s': '%s' is not an IPv4 address", ipRange, startStr)
+	}
+
+	endStr = strings.TrimSpace(endStr)
+	if !strings.Contains(endStr, ".") {
+		// Short form, the end is the last octet of the start address.
+		endStr = fmt.Sprintf("%d.%d.%d.%s", start[0], start[1], start[2], endStr)
+	}
+	end := net.ParseIP(endStr).To4()
+	if end == nil {
+		return nil, fmt.Errorf("invalid range '%s': '%s' is not an IPv4 address", ipRange, endStr)
+	}
+	if binary.BigEndian.Uint32(start) > binary.BigEndian.Uint32(end) {
+		return nil, fmt.Errorf("invalid range '%s': start is after end", ipRange)
+	}
+	if binary.BigEndian.Uint32(end)-binary.BigEndian.Uint32(start) >= maxTargetHosts {
+		return nil, fmt.Errorf("invalid range '%s': more than %d addresses", ipRange, maxTargetHosts)
+	}
+	return inclusiveIPs(start, end), nil
+}
+
+// inclusiveIPs returns every address from start to end, including both.
+func inclusiveIPs(start, end net.IP) []net.IP {
+	first := binary.BigEndian.Uint32(start.To4())
+	last := binary.BigEndian.Uint32(end.To4())
+
+	var ips []net.IP
+	for i := first; i >= first && i <= last; i++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, i)
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+// findInterfaceForSubnet returns the interface whose IPv4 subnet contains the given IP, or nil if
+// the IP is not on a directly attached network.
+func findInterfaceForSubnet(ip net.IP) *net.Interface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	for i := range ifaces {
+		if ipNet := interfaceIPv4Net(&ifaces[i]); ipNet != nil && ipNet.Contains(ip) {
+			return &ifaces[i]
+		}
+	}
+	return nil
+}
+
+// interfaceIPv4Net returns the first IPv4 network configured on the given interface.
+func interfaceIPv4Net(iface *net.Interface) *net.IPNet {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package network
+
+import (
+	"testing"
+)
+
+// TestResolveScanTarget verifies that CIDRs and ranges are expanded into a de-duplicated list of host addresses.
+func TestResolveScanTarget(t *testing.T) {
+	target, err := ResolveScanTarget([]string{"10.0.0.0/30", "10.0.0.5/32"}, []string{"10.0.0.2-10.0.0.4", "10.0.0.9-10"}, "")
+	if err != nil {
+		t.Fatalf("ResolveScanTarget() failed with %v", err)
+	}
+
+	expected := []string{"10.0.0.1", "10.0.0.2", "10.0.0.5", "10.0.0.3", "10.0.0.4", "10.0.0.9", "10.0.0.10"}
+	if len(target.IPs) != len(expected) {
+		t.Fatalf("unexpected target IPs.\ngot:  %v\nwant: %v", target.IPs, expected)
+	}
+	for i, ip := range target.IPs {
+		if ip.String() != expected[i] {
+			t.Errorf("unexpected target IP at %d.\ngot:  %s\nwant: %s", i, ip, expected[i])
+		}
+	}
+	if !target.Contains("10.0.0.9") || target.Contains("10.0.0.8") || target.Contains("192.168.1.9") {
+		t.Error("Contains() does not match the target IPs")
+	}
+}
+
+// TestResolveScanTargetInvalid verifies that malformed and oversized targets are rejected.
+func TestResolveScanTargetInvalid(t *testing.T) {
+	tests := []struct {
+		cidrs  []string
+		ranges []string
+	}{
+		{cidrs: []string{"192.168.1.0"}},
+		{cidrs: []string{"fe80::/64"}},
+		{cidrs: []string{"10.0.0.0/8"}},
+		{ranges: []string{"192.168.1.50-10"}},
+		{ranges: []string{"192.168.1.10"}},
+	}
+	for _, tt := range tests {
+		if _, err := ResolveScanTarget(tt.cidrs, tt.ranges, ""); err == nil {
+			t.Errorf("expected an error for cidrs %v and ranges %v, got nil", tt.cidrs, tt.ranges)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package oui
+
+import (
+	"bufio"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// embeddedTable is the IEEE OUI registry compiled into the binary, so vendor lookups never need a network fetch.
+//
+//go:embed oui.txt
+var embeddedTable string
+
+var (
+	table     map[string]string
+	tableOnce sync.Once
+	tableMu   sync.RWMutex
+)
+
+// hexLinePattern matches the "(hex)" lines of the IEEE oui.txt download, e.g. "28-6F-B9   (hex)		Nokia".
+var hexLinePattern = regexp.MustCompile(`^\s*([0-9A-Fa-f]{2})-([0-9A-Fa-f]{2})-([0-9A-Fa-f]{2})\s+\(hex\)\s+(.+)$`)
+
+// prefixPattern matches a bare 6 hex digit OUI.
+var prefixPattern = regexp.MustCompile(`^[0-9A-Fa-f]{6}$`)
+
+// Lookup returns the name of the organisation that registered the OUI of the given MAC address.
+// It returns an empty string if the MAC address is invalid, locally administered (randomised) or unknown.
+func Lookup(macStr string) string {
+	mac, err := net.ParseMAC(macStr)
+	if err != nil || len(mac) < 3 {
+		return ""
+	}
+	// The locally administered bit is set on randomised MAC addresses, which have no registered owner.
+	if mac[0]&0x02 != 0 {
+		return ""
+	}
+
+	loadEmbedded()
+	tableMu.RLock()
+	defer tableMu.RUnlock()
+	return table[strings.ToUpper(mac[:3].String())]
+}
+
+// LoadFile refreshes the vendor table from a local file, taking precedence over the embedded table.
+// The file can be the oui.txt or oui.csv downloaded from the IEEE, or the tab separated format
+// used by the embedded table.
+func LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entries, err := parse(file)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no OUI assignments found in %s", path)
+	}
+
+	loadEmbedded()
+	tableMu.Lock()
+	defer tableMu.Unlock()
+	for prefix, vendor := range entries {
+		table[prefix] = vendor
+	}
+	return nil
+}
+
+// LabelDevices sets the vendor of every device that has a MAC address but no vendor yet.
+func LabelDevices(devices map[string]*model.Device) {
+	for _, device := range devices {
+		if device.MAC != "" && device.Vendor == "" {
+			device.Vendor = Lookup(device.MAC)
+		}
+	}
+}
+
+// loadEmbedded parses the embedded table the first time a lookup is made.
+func loadEmbedded() {
+	tableOnce.Do(func() {
+		entries, _ := parse(strings.NewReader(embeddedTable))
+		tableMu.Lock()
+		table = entries
+		tableMu.Unlock()
+	})
+}
+
+// parse reads OUI assignments from any of the supported file formats. Keys are returned
+// in the "AA:BB:CC" form produced by net.HardwareAddr, upper-cased.
+func parse(r io.Reader) (map[string]string, error) {
+	entries := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// IEEE oui.txt format.
+		if match := hexLinePattern.FindStringSubmatch(line); match != nil {
+			entries[strings.ToUpper(match[1]+":"+match[2]+":"+match[3])] = strings.TrimSpace(match[4])
+			continue
+		}
+
+		// Embedded table format: "<prefix>\t<vendor>".
+		if prefix, vendor, found := strings.Cut(line, "\t"); found && prefixPattern.MatchString(prefix) {
+			entries[formatPrefix(prefix)] = strings.TrimSpace(vendor)
+			continue
+		}
+
+		// IEEE oui.csv format: "MA-L,<prefix>,<vendor>,<address>". The vendor may be quoted.
+		if strings.HasPrefix(line, "MA-L,") {
+			record, err := csv.NewReader(strings.NewReader(line)).Read()
+			if err == nil && len(record) >= 3 && prefixPattern.MatchString(record[1]) {
+				entries[formatPrefix(record[1])] = strings.TrimSpace(record[2])
+			}
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// formatPrefix converts a bare 6 hex digit OUI into the "AA:BB:CC" key form.
+func formatPrefix(prefix string) string {
+	prefix = strings.ToUpper(prefix)
+	return prefix[0:2] + ":" + prefix[2:4] + ":" + prefix[4:6]
+}
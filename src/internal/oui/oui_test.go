@@ -0,0 +1,77 @@
+package oui
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLookup verifies that vendors are resolved from the embedded table and that
+// randomised and invalid MAC addresses are not given a vendor.
+func TestLookup(t *testing.T) {
+	tests := map[string]string{
+		"24:0a:c4:12:34:56": "Espressif Inc.",
+		"B8-27-EB-12-34-56": "Raspberry Pi Foundation",
+		"d8:3a:dd:12:34:56": "Raspberry Pi Trading Ltd",
+		"10:d5:61:12:34:56": "Tuya Smart Inc.",
+		"3c:61:05:12:34:56": "Espressif Inc.",
+		"02:0a:c4:12:34:56": "", // Locally administered.
+		"not-a-mac":         "",
+	}
+	for mac, expected := range tests {
+		if got := Lookup(mac); got != expected {
+			t.Errorf("unexpected vendor for %s.\ngot:  %q\nwant: %q", mac, got, expected)
+		}
+	}
+}
+
+// TestLoadFile verifies that both IEEE download formats are accepted and override the embedded table.
+func TestLoadFile(t *testing.T) {
+	restoreTable(t)
+	path := filepath.Join(t.TempDir(), "oui.txt")
+	content := "Registry,Assignment,Organization Name,Organization Address\n" +
+		"MA-L,240AC4,\"Espressif, Refreshed\",Shanghai CN\n" +
+		"FC-FF-FF   (hex)\t\tExample Vendor Ltd\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write OUI file: %v", err)
+	}
+
+	if err := LoadFile(path); err != nil {
+		t.Fatalf("LoadFile() failed with %v", err)
+	}
+	if got := Lookup("24:0a:c4:00:00:01"); got != "Espressif, Refreshed" {
+		t.Errorf("unexpected vendor from CSV format.\ngot:  %q\nwant: %q", got, "Espressif, Refreshed")
+	}
+	if got := Lookup("fc:ff:ff:00:00:01"); got != "Example Vendor Ltd" {
+		t.Errorf("unexpected vendor from TXT format.\ngot:  %q\nwant: %q", got, "Example Vendor Ltd")
+	}
+}
+
+// TestLoadFileEmpty verifies that a file without any OUI assignments is rejected rather than silently ignored.
+func TestLoadFileEmpty(t *testing.T) {
+	restoreTable(t)
+	path := filepath.Join(t.TempDir(), "oui.txt")
+	if err := os.WriteFile(path, []byte("<html><body>Not Found</body></html>\n"), 0o644); err != nil {
+		t.Fatalf("failed to write OUI file: %v", err)
+	}
+
+	if err := LoadFile(path); err == nil {
+		t.Error("expected an error for a file with no OUI assignments")
+	}
+}
+
+// restoreTable puts the embedded vendor table back once the test finishes, so files loaded
+// by one test do not leak into the lookups of another.
+func restoreTable(t *testing.T) {
+	t.Helper()
+	loadEmbedded()
+	tableMu.RLock()
+	saved := maps.Clone(table)
+	tableMu.RUnlock()
+	t.Cleanup(func() {
+		tableMu.Lock()
+		table = saved
+		tableMu.Unlock()
+	})
+}
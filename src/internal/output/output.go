@@ -0,0 +1,185 @@
+package output
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// Formats lists the supported values of the --output flag.
+var Formats = []string{"json", "yaml", "csv", "table"}
+
+// csvHeader is the column order used by the csv and table formats. The names match the
+// JSON and YAML keys of model.Device so that every format shares one schema.
+var csvHeader = []string{"addrV4", "addrV6", "mac", "vendor", "hostname", "canConnectSSH", "sshPort", "openPorts", "protocols", "sources", "services", "unknown"}
+
+// IsValidFormat reports whether the given format is one of the supported output formats.
+func IsValidFormat(format string) bool {
+	return slices.Contains(Formats, format)
+}
+
+// WriteDevices writes the devices to w in the given format, sorted by IPv4 address.
+// The json and yaml formats write a list of model.Device objects. The csv and table formats
+// write one row per device, with the open ports and sources joined by ';', the banners summarised as
+// "<port>/<protocol>" and the services summarised as "<type>:<port>", both joined by ';'.
+func WriteDevices(w io.Writer, format string, devices map[string]*model.Device) error {
+	sorted := SortDevices(devices)
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(sorted)
+	case "yaml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(sorted); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return err
+		}
+		for _, device := range sorted {
+			if err := writer.Write(deviceRow(device)); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case "table":
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.ToUpper(strings.Join(csvHeader, "\t")))
+		for _, device := range sorted {
+			row := deviceRow(device)
+			for i, field := range row {
+				if field == "" {
+					row[i] = "-"
+				}
+			}
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		return writer.Flush()
+	default:
+		return fmt.Errorf("unsupported output format %q, expected one of: %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+// savedHeader is the column order of the saved devices table, showing the settings used to connect to each device.
+var savedHeader = []string{"addrV4", "alias", "hostname", "mac", "user", "sshPort", "identityFile", "jumpHosts", "tags"}
+
+// WriteSavedDevices writes the saved devices to w as a table, in the order they were saved.
+// Empty fields are shown as "-" and the jump hosts and tags are joined by ','.
+func WriteSavedDevices(w io.Writer, devices []model.Device) error {
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.ToUpper(strings.Join(savedHeader, "\t")))
+	for _, device := range devices {
+		row := []string{
+			device.AddrV4,
+			device.Alias,
+			device.Hostname,
+			device.MAC,
+			device.User,
+			formatPort(device.SSHPort),
+			device.IdentityFile,
+			strings.Join(device.JumpHosts, ","),
+			strings.Join(device.Tags, ","),
+		}
+		for i, field := range row {
+			if field == "" {
+				row[i] = "-"
+			}
+		}
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
+
+// SortDevices returns the devices as a slice ordered numerically by IPv4 address. Addresses
+// that cannot be parsed are placed last, ordered as strings, so the order is always stable.
+func SortDevices(devices map[string]*model.Device) []*model.Device {
+	sorted := make([]*model.Device, 0, len(devices))
+	for _, device := range devices {
+		sorted = append(sorted, device)
+	}
+	slices.SortStableFunc(sorted, func(a, b *model.Device) int {
+		addrA, errA := netip.ParseAddr(a.AddrV4)
+		addrB, errB := netip.ParseAddr(b.AddrV4)
+		switch {
+		case errA == nil && errB == nil:
+			return addrA.Compare(addrB)
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		default:
+			return strings.Compare(a.AddrV4, b.AddrV4)
+		}
+	})
+	return sorted
+}
+
+// deviceRow flattens a device into the columns of csvHeader.
+func deviceRow(device *model.Device) []string {
+	return []string{
+		device.AddrV4,
+		device.AddrV6,
+		device.MAC,
+		device.Vendor,
+		device.Hostname,
+		strconv.FormatBool(device.CanConnectSSH),
+		formatPort(device.SSHPort),
+		strings.Join(formatPorts(device.OpenPorts), ";"),
+		strings.Join(protocolSummaries(device.Banners), ";"),
+		strings.Join(device.Sources, ";"),
+		strings.Join(serviceSummaries(device.Services), ";"),
+		strconv.FormatBool(device.Unknown),
+	}
+}
+
+// formatPort returns the port as a string, or an empty string when the port is not set.
+func formatPort(port int) string {
+	if port == 0 {
+		return ""
+	}
+	return strconv.Itoa(port)
+}
+
+// formatPorts converts a list of ports into strings.
+func formatPorts(ports []int) []string {
+	formatted := make([]string, 0, len(ports))
+	for _, port := range ports {
+		formatted = append(formatted, strconv.Itoa(port))
+	}
+	return formatted
+}
+
+// protocolSummaries returns each identified port as "<port>/<protocol>", for formats that cannot nest the full banners.
+func protocolSummaries(banners []model.PortBanner) []string {
+	summaries := make([]string, 0, len(banners))
+	for _, banner := range banners {
+		summaries = append(summaries, strconv.Itoa(banner.Port)+"/"+banner.Protocol)
+	}
+	return summaries
+}
+
+// serviceSummaries returns each service as "<type>:<port>", for formats that cannot nest the full records.
+func serviceSummaries(services []model.Service) []string {
+	summaries := make([]string, 0, len(services))
+	for _, service := range services {
+		summaries = append(summaries, service.Type+":"+strconv.Itoa(service.Port))
+	}
+	return summaries
+}
@@ -0,0 +1,57 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// TestWriteDevicesCSV verifies that devices are written in numeric IP order with the documented columns.
+func TestWriteDevicesCSV(t *testing.T) {
+	devices := map[string]*model.Device{
+		"192.168.1.10": {AddrV4: "192.168.1.10", Hostname: "printer", Sources: []string{"ICMP"}, Unknown: true},
+		"192.168.1.9": {AddrV4: "192.168.1.9", MAC: "24:0a:c4:12:34:56", Vendor: "Espressif Inc.", CanConnectSSH: true, SSHPort: 2222, OpenPorts: []int{80, 2222},
+			Banners: []model.PortBanner{{Port: 80, Protocol: "http"}, {Port: 2222, Protocol: "ssh"}}, Sources: []string{"ARP", "mDNS"},
+			Services: []model.Service{{Instance: "plug", Type: "_esphomelib._tcp", Port: 6053}}},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := WriteDevices(buf, "csv", devices); err != nil {
+		t.Fatalf("WriteDevices() failed with %v", err)
+	}
+
+	expected := "addrV4,addrV6,mac,vendor,hostname,canConnectSSH,sshPort,openPorts,protocols,sources,services,unknown\n" +
+		"192.168.1.9,,24:0a:c4:12:34:56,Espressif Inc.,,true,2222,80;2222,80/http;2222/ssh,ARP;mDNS,_esphomelib._tcp:6053,false\n" +
+		"192.168.1.10,,,,printer,false,,,,ICMP,,true\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("unexpected csv output.\ngot:  %q\nwant: %q", got, expected)
+	}
+}
+
+// TestWriteDevicesInvalidFormat verifies that an unknown format is rejected.
+func TestWriteDevicesInvalidFormat(t *testing.T) {
+	if err := WriteDevices(new(bytes.Buffer), "xml", map[string]*model.Device{}); err == nil {
+		t.Error("expected an error for an unsupported format, got nil")
+	}
+}
+
+// TestWriteSavedDevices verifies that saved devices are written in saved order with their connection settings.
+func TestWriteSavedDevices(t *testing.T) {
+	devices := []model.Device{
+		{AddrV4: "192.168.1.20", Hostname: "raspberrypi", Alias: "garage-pi", User: "pi", SSHPort: 2222, Tags: []string{"garage", "pi"}},
+		{AddrV4: "10.20.0.15", JumpHosts: []string{"garage-pi"}},
+	}
+
+	buf := new(bytes.Buffer)
+	if err := WriteSavedDevices(buf, devices); err != nil {
+		t.Fatalf("WriteSavedDevices() failed with %v", err)
+	}
+
+	expected := "ADDRV4        ALIAS      HOSTNAME     MAC  USER  SSHPORT  IDENTITYFILE  JUMPHOSTS  TAGS\n" +
+		"192.168.1.20  garage-pi  raspberrypi  -    pi    2222     -             -          garage,pi\n" +
+		"10.20.0.15    -          -            -    -     -        -             garage-pi  -\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("unexpected table output.\ngot:\n%s\nwant:\n%s", got, expected)
+	}
+}
@@ -0,0 +1,64 @@
+package output
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// PrefixWriter writes each line written to it to an underlying writer with a prefix, such as the
+// name of the host that produced it. Several PrefixWriters can share one writer and mutex, so
+// that lines from concurrent sources are interleaved whole rather than mixed mid-line.
+type PrefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix []byte
+	buf    []byte
+}
+
+// NewPrefixWriter returns a PrefixWriter that writes prefixed lines to w, holding mu while it writes.
+func NewPrefixWriter(w io.Writer, mu *sync.Mutex, prefix string) *PrefixWriter {
+	return &PrefixWriter{w: w, mu: mu, prefix: []byte(prefix)}
+}
+
+// Write buffers p and writes every complete line in it. It always reports all of p as written,
+// unless the underlying writer fails.
+func (p *PrefixWriter) Write(data []byte) (int, error) {
+	p.buf = append(p.buf, data...)
+	end := bytes.LastIndexByte(p.buf, '\n')
+	if end < 0 {
+		return len(data), nil
+	}
+	lines := p.buf[:end+1]
+	p.buf = append([]byte(nil), p.buf[end+1:]...)
+	if err := p.writeLines(lines); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Flush writes any final line that did not end with a newline.
+func (p *PrefixWriter) Flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLines(line)
+}
+
+// writeLines writes newline terminated lines, each with the prefix.
+func (p *PrefixWriter) writeLines(lines []byte) error {
+	var out bytes.Buffer
+	for len(lines) > 0 {
+		end := bytes.IndexByte(lines, '\n')
+		out.Write(p.prefix)
+		out.Write(lines[:end+1])
+		lines = lines[end+1:]
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := p.w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,28 @@
+package output
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+// TestPrefixWriter verifies that lines split across writes are prefixed once, and that Flush writes a final partial line.
+func TestPrefixWriter(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	writer := NewPrefixWriter(&buf, &mu, "[pi] ")
+
+	for _, chunk := range []string{"load av", "erage: 0.1\nup 3 ", "days\n", "no newline"} {
+		if _, err := writer.Write([]byte(chunk)); err != nil {
+			t.Fatalf("Write() failed with %v", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Flush() failed with %v", err)
+	}
+
+	want := "[pi] load average: 0.1\n[pi] up 3 days\n[pi] no newline\n"
+	if buf.String() != want {
+		t.Errorf("unexpected output.\ngot:  %q\nwant: %q", buf.String(), want)
+	}
+}
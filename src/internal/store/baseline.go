@@ -0,0 +1,114 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// baselineKey is the configuration setting the baseline is kept in.
+const baselineKey = "baseline"
+
+// ErrBaselineEntryNotFound is returned when no baseline entry matches the given reference.
+var ErrBaselineEntryNotFound = errors.New("no baseline entry matches")
+
+// BaselineStore reads and writes the baseline of devices known to belong on the network, kept in the
+// configuration file. Every change is written to the file straight away.
+type BaselineStore struct {
+	mu sync.Mutex
+	v  *viper.Viper
+}
+
+// NewBaselineStore returns a store for the baseline in the configuration held by v.
+func NewBaselineStore(v *viper.Viper) *BaselineStore {
+	return &BaselineStore{v: v}
+}
+
+// Baseline returns the store for the configuration file loaded by the root command.
+var Baseline = sync.OnceValue(func() *BaselineStore {
+	return NewBaselineStore(viper.GetViper())
+})
+
+// List returns every baseline entry.
+func (s *BaselineStore) List() ([]model.BaselineEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read()
+}
+
+// Save replaces the baseline with the entries, dropping duplicates.
+func (s *BaselineStore) Save(entries []model.BaselineEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var unique []model.BaselineEntry
+	for _, entry := range entries {
+		if !slices.Contains(unique, entry) {
+			unique = append(unique, entry)
+		}
+	}
+	return s.write(unique)
+}
+
+// Add appends an entry to the baseline. An entry that is already there is not added again, and false is returned.
+func (s *BaselineStore) Add(entry model.BaselineEntry) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry == (model.BaselineEntry{}) {
+		return false, errors.New("a baseline entry needs a MAC address, IPv4 address or hostname")
+	}
+	entries, err := s.read()
+	if err != nil {
+		return false, err
+	}
+	if slices.Contains(entries, entry) {
+		return false, nil
+	}
+	return true, s.write(append(entries, entry))
+}
+
+// Remove deletes the first baseline entry with a MAC address, IPv4 address or hostname equal to ref, and returns it.
+func (s *BaselineStore) Remove(ref string) (model.BaselineEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := s.read()
+	if err != nil {
+		return model.BaselineEntry{}, err
+	}
+	i := slices.IndexFunc(entries, func(entry model.BaselineEntry) bool {
+		return (entry.MAC != "" && strings.EqualFold(entry.MAC, ref)) ||
+			entry.AddrV4 == ref ||
+			(entry.Hostname != "" && strings.EqualFold(entry.Hostname, ref))
+	})
+	if i < 0 {
+		return model.BaselineEntry{}, fmt.Errorf("%w '%s'", ErrBaselineEntryNotFound, ref)
+	}
+	removed := entries[i]
+	return removed, s.write(slices.Delete(entries, i, i+1))
+}
+
+// read returns the baseline from the configuration.
+func (s *BaselineStore) read() ([]model.BaselineEntry, error) {
+	var entries []model.BaselineEntry
+	if err := s.v.UnmarshalKey(baselineKey, &entries); err != nil {
+		return nil, fmt.Errorf("failed to read '%s' from the configuration file: %w", baselineKey, err)
+	}
+	return entries, nil
+}
+
+// write replaces the baseline and writes the configuration file.
+func (s *BaselineStore) write(entries []model.BaselineEntry) error {
+	if entries == nil {
+		entries = []model.BaselineEntry{}
+	}
+	s.v.Set(baselineKey, entries)
+	if err := s.v.WriteConfig(); err != nil {
+		return fmt.Errorf("failed to write the configuration file: %w", err)
+	}
+	return nil
+}
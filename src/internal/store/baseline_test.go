@@ -0,0 +1,61 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// TestBaselineStore verifies that baseline entries can be saved, added and removed, and that every change is written to the file.
+func TestBaselineStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "configuration.yaml")
+	if err := os.WriteFile(path, []byte("debug: false\n"), 0o644); err != nil {
+		t.Fatalf("failed to write configuration: %v", err)
+	}
+	load := func() *viper.Viper {
+		v := viper.New()
+		v.SetConfigFile(path)
+		v.SetConfigType("yaml")
+		if err := v.ReadInConfig(); err != nil {
+			t.Fatalf("failed to read configuration: %v", err)
+		}
+		return v
+	}
+	store := NewBaselineStore(load())
+
+	if entries, err := store.List(); err != nil || len(entries) != 0 {
+		t.Fatalf("List() of a new file = %v, %v, want no entries", entries, err)
+	}
+	pi := model.BaselineEntry{MAC: "b8:27:eb:12:34:56"}
+	printer := model.BaselineEntry{Hostname: "printer"}
+	if err := store.Save([]model.BaselineEntry{pi, printer, pi}); err != nil {
+		t.Fatalf("Save() failed with %v", err)
+	}
+	router := model.BaselineEntry{AddrV4: "192.168.1.1"}
+	if added, err := store.Add(router); err != nil || !added {
+		t.Errorf("Add() = %v, %v, want true, nil", added, err)
+	}
+	if added, err := store.Add(printer); err != nil || added {
+		t.Errorf("Add() of a duplicate = %v, %v, want false, nil", added, err)
+	}
+	if removed, err := store.Remove("PRINTER"); err != nil || removed != printer {
+		t.Errorf("Remove() = %+v, %v, want %+v", removed, err, printer)
+	}
+	if _, err := store.Remove("printer"); !errors.Is(err, ErrBaselineEntryNotFound) {
+		t.Errorf("Remove() of a missing entry returned %v, want ErrBaselineEntryNotFound", err)
+	}
+
+	entries, err := NewBaselineStore(load()).List()
+	if err != nil {
+		t.Fatalf("List() failed with %v", err)
+	}
+	if want := []model.BaselineEntry{pi, router}; !slices.Equal(entries, want) {
+		t.Errorf("file has %+v, want %+v", entries, want)
+	}
+}
@@ -0,0 +1,263 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// devicesKey is the configuration setting the saved devices are kept in.
+const devicesKey = "selected_devices"
+
+// ErrDeviceNotFound is returned when no saved device matches the given reference.
+var ErrDeviceNotFound = errors.New("no saved device matches")
+
+// ErrInvalidAlias is returned when an alias contains spaces or would name more than one saved device.
+var ErrInvalidAlias = errors.New("invalid alias")
+
+// DeviceStore reads and writes the saved devices in the configuration file. Every change is
+// written to the file straight away. Devices are referred to by IPv4 address, alias, hostname
+// or MAC address, as with model.FindDevice.
+type DeviceStore struct {
+	mu sync.Mutex
+	v  *viper.Viper
+}
+
+// NewDeviceStore returns a store for the saved devices in the configuration held by v.
+func NewDeviceStore(v *viper.Viper) *DeviceStore {
+	return &DeviceStore{v: v}
+}
+
+// Devices returns the store for the configuration file loaded by the root command.
+var Devices = sync.OnceValue(func() *DeviceStore {
+	return NewDeviceStore(viper.GetViper())
+})
+
+// List returns every saved device, in the order they were saved.
+func (s *DeviceStore) List() ([]model.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read()
+}
+
+// Get returns the saved device matching ref.
+func (s *DeviceStore) Get(ref string) (model.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	devices, err := s.read()
+	if err != nil {
+		return model.Device{}, err
+	}
+	device := model.FindDevice(devices, ref)
+	if device == nil {
+		return model.Device{}, fmt.Errorf("%w '%s'", ErrDeviceNotFound, ref)
+	}
+	return *device, nil
+}
+
+// Add saves a device. A device that is already saved is not added again, and false is returned.
+// Devices are the same when they share a stable ID or identity key, or have the same IPv4 address
+// and either has no identity, as with devices saved before IDs were recorded.
+func (s *DeviceStore) Add(device model.Device) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	devices, err := s.read()
+	if err != nil {
+		return false, err
+	}
+	if device.ID == "" {
+		device.ID = device.StableID()
+	}
+	if model.FindSameDevice(devices, &device) != nil {
+		return false, nil
+	}
+	if err := checkAlias(devices, device.AddrV4, device.Alias); err != nil {
+		return false, err
+	}
+	return true, s.write(append(devices, device))
+}
+
+// AddressChange is a saved device found at a new address by a scan.
+type AddressChange struct {
+	Device    model.Device
+	OldAddrV4 string
+}
+
+// Reconcile matches the devices found by a scan against the saved devices, by stable ID or identity
+// key, or by IPv4 address and hostname for saved devices without an identity, and updates the last known address of every saved device that was found. Identity keys the
+// saved device is missing, such as a MAC address found for the first time, are saved too, so it can
+// be recognised after its address changes. The saved devices whose IPv4 address changed are returned.
+// The configuration file is only written when something changed.
+func (s *DeviceStore) Reconcile(discovered map[string]*model.Device) ([]AddressChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	devices, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]model.Device, 0, len(discovered))
+	for _, device := range discovered {
+		found = append(found, *device)
+	}
+
+	var changes []AddressChange
+	changed := false
+	for i := range devices {
+		saved := &devices[i]
+		match := model.FindSameDevice(found, saved)
+		if match == nil {
+			continue
+		}
+		// A device matched by address alone may be a different device that was given the address,
+		// so its identity is only adopted when the hostname matches too.
+		if !model.SameDevice(saved, match) && !sameHostname(saved, match) {
+			continue
+		}
+		if updateSavedDevice(saved, match) {
+			changed = true
+		}
+		if saved.AddrV4 != match.AddrV4 {
+			oldAddrV4 := saved.AddrV4
+			saved.AddrV4 = match.AddrV4
+			changes = append(changes, AddressChange{Device: *saved, OldAddrV4: oldAddrV4})
+			changed = true
+		}
+	}
+	if !changed {
+		return nil, nil
+	}
+	return changes, s.write(devices)
+}
+
+// updateSavedDevice copies the IPv6 address and any identity the saved device is missing from the
+// device found by a scan. It reports whether anything changed.
+func updateSavedDevice(saved, found *model.Device) bool {
+	before := []string{saved.ID, saved.AddrV6, saved.MAC, saved.HostKey}
+	if found.AddrV6 != "" {
+		saved.AddrV6 = found.AddrV6
+	}
+	if saved.MAC == "" {
+		saved.MAC = found.MAC
+	}
+	if found.HostKey != "" {
+		saved.HostKey = found.HostKey
+	}
+	if saved.ID == "" {
+		saved.ID = found.ID
+		if saved.ID == "" {
+			saved.ID = found.StableID()
+		}
+	}
+	return !slices.Equal(before, []string{saved.ID, saved.AddrV6, saved.MAC, saved.HostKey})
+}
+
+// sameHostname reports whether both devices have a hostname, and it is the same.
+func sameHostname(a, b *model.Device) bool {
+	hostnameA, hostnameB := strings.TrimSuffix(a.Hostname, "."), strings.TrimSuffix(b.Hostname, ".")
+	return hostnameA != "" && strings.EqualFold(hostnameA, hostnameB)
+}
+
+// Remove deletes the saved device matching ref, and returns it.
+func (s *DeviceStore) Remove(ref string) (model.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	devices, err := s.read()
+	if err != nil {
+		return model.Device{}, err
+	}
+	i := indexOf(devices, ref)
+	if i < 0 {
+		return model.Device{}, fmt.Errorf("%w '%s'", ErrDeviceNotFound, ref)
+	}
+	removed := devices[i]
+	return removed, s.write(append(devices[:i], devices[i+1:]...))
+}
+
+// Update changes the saved device matching ref with the update function and saves the result,
+// which is returned. Nothing is saved if update returns an error. The new alias must not be
+// the name of another saved device.
+func (s *DeviceStore) Update(ref string, update func(device *model.Device) error) (model.Device, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	devices, err := s.read()
+	if err != nil {
+		return model.Device{}, err
+	}
+	i := indexOf(devices, ref)
+	if i < 0 {
+		return model.Device{}, fmt.Errorf("%w '%s'", ErrDeviceNotFound, ref)
+	}
+	device := devices[i]
+	if err := update(&device); err != nil {
+		return model.Device{}, err
+	}
+	if device.Alias != devices[i].Alias {
+		if err := checkAlias(devices, devices[i].AddrV4, device.Alias); err != nil {
+			return model.Device{}, err
+		}
+	}
+	devices[i] = device
+	return device, s.write(devices)
+}
+
+// read returns the saved devices from the configuration.
+func (s *DeviceStore) read() ([]model.Device, error) {
+	var devices []model.Device
+	if err := s.v.UnmarshalKey(devicesKey, &devices); err != nil {
+		return nil, fmt.Errorf("failed to read '%s' from the configuration file: %w", devicesKey, err)
+	}
+	return devices, nil
+}
+
+// write replaces the saved devices and writes the configuration file.
+func (s *DeviceStore) write(devices []model.Device) error {
+	if devices == nil {
+		devices = []model.Device{}
+	}
+	s.v.Set(devicesKey, devices)
+	if err := s.v.WriteConfig(); err != nil {
+		return fmt.Errorf("failed to write the configuration file: %w", err)
+	}
+	return nil
+}
+
+// indexOf returns the index of the device matching ref, or -1 if there is none.
+func indexOf(devices []model.Device, ref string) int {
+	device := model.FindDevice(devices, ref)
+	if device == nil {
+		return -1
+	}
+	for i := range devices {
+		if &devices[i] == device {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkAlias returns an error if the alias would also refer to a saved device other than the one
+// at addrV4, so that every alias names exactly one device.
+func checkAlias(devices []model.Device, addrV4, alias string) error {
+	if alias == "" {
+		return nil
+	}
+	if strings.ContainsAny(alias, " \t") {
+		return fmt.Errorf("%w '%s', it must not contain spaces", ErrInvalidAlias, alias)
+	}
+	for _, device := range devices {
+		if device.AddrV4 == addrV4 {
+			continue
+		}
+		if model.FindDevice([]model.Device{device}, alias) != nil {
+			return fmt.Errorf("%w '%s', it is already used by the saved device %s", ErrInvalidAlias, alias, device.AddrV4)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// newTestStore returns a store backed by a configuration file in a temporary directory,
+// along with a function that reads the devices back from the file.
+func newTestStore(t *testing.T) (*DeviceStore, func() []model.Device) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "configuration.yaml")
+	if err := os.WriteFile(path, []byte("debug: false\nselected_devices: []\n"), 0o644); err != nil {
+		t.Fatalf("failed to write configuration: %v", err)
+	}
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatalf("failed to read configuration: %v", err)
+	}
+
+	reload := func() []model.Device {
+		t.Helper()
+		fresh := viper.New()
+		fresh.SetConfigFile(path)
+		fresh.SetConfigType("yaml")
+		if err := fresh.ReadInConfig(); err != nil {
+			t.Fatalf("failed to read configuration: %v", err)
+		}
+		devices, err := NewDeviceStore(fresh).List()
+		if err != nil {
+			t.Fatalf("List() failed with %v", err)
+		}
+		return devices
+	}
+	return NewDeviceStore(v), reload
+}
+
+// TestDeviceStore verifies that devices can be added, updated and removed, and that every change is written to the file.
+func TestDeviceStore(t *testing.T) {
+	store, reload := newTestStore(t)
+
+	for _, device := range []model.Device{
+		{AddrV4: "192.168.1.10", Hostname: "printer", MAC: "aa:bb:cc:dd:ee:ff"},
+		{AddrV4: "192.168.1.20", Hostname: "raspberrypi", User: "pi"},
+	} {
+		if added, err := store.Add(device); err != nil || !added {
+			t.Fatalf("Add(%s) = %v, %v, want true, nil", device.AddrV4, added, err)
+		}
+	}
+	if added, err := store.Add(model.Device{AddrV4: "192.168.1.20"}); err != nil || added {
+		t.Errorf("Add() of a duplicate = %v, %v, want false, nil", added, err)
+	}
+
+	updated, err := store.Update("raspberrypi", func(device *model.Device) error {
+		device.Alias = "garage-pi"
+		device.Tags = append(device.Tags, "garage")
+		device.SSHPort = 2222
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update() failed with %v", err)
+	}
+	if updated.Alias != "garage-pi" || updated.User != "pi" {
+		t.Errorf("Update() returned %+v", updated)
+	}
+
+	devices := reload()
+	if len(devices) != 2 {
+		t.Fatalf("expected 2 saved devices, got %d", len(devices))
+	}
+	if got := devices[1]; got.Alias != "garage-pi" || !slices.Equal(got.Tags, []string{"garage"}) || got.SSHPort != 2222 || got.User != "pi" {
+		t.Errorf("unexpected saved device: %+v", got)
+	}
+
+	got, err := store.Get("GARAGE-PI")
+	if err != nil || got.AddrV4 != "192.168.1.20" {
+		t.Errorf("Get() by alias = %+v, %v", got, err)
+	}
+
+	removed, err := store.Remove("AA:BB:CC:DD:EE:FF")
+	if err != nil || removed.AddrV4 != "192.168.1.10" {
+		t.Fatalf("Remove() = %+v, %v", removed, err)
+	}
+	if devices := reload(); len(devices) != 1 || devices[0].AddrV4 != "192.168.1.20" {
+		t.Errorf("unexpected saved devices after Remove(): %+v", devices)
+	}
+}
+
+// TestDeviceStoreErrors verifies that unknown devices and conflicting aliases are rejected without changing the file.
+func TestDeviceStoreErrors(t *testing.T) {
+	store, reload := newTestStore(t)
+	for _, device := range []model.Device{
+		{AddrV4: "192.168.1.10", Hostname: "printer"},
+		{AddrV4: "192.168.1.20", Hostname: "raspberrypi"},
+	} {
+		if _, err := store.Add(device); err != nil {
+			t.Fatalf("Add(%s) failed with %v", device.AddrV4, err)
+		}
+	}
+
+	if _, err := store.Get("tv"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Get() of an unknown device returned %v, want ErrDeviceNotFound", err)
+	}
+	if _, err := store.Remove("tv"); !errors.Is(err, ErrDeviceNotFound) {
+		t.Errorf("Remove() of an unknown device returned %v, want ErrDeviceNotFound", err)
+	}
+
+	for _, alias := range []string{"printer", "192.168.1.10", "garage pi"} {
+		_, err := store.Update("raspberrypi", func(device *model.Device) error {
+			device.Alias = alias
+			return nil
+		})
+		if !errors.Is(err, ErrInvalidAlias) {
+			t.Errorf("Update() with alias %q returned %v, want ErrInvalidAlias", alias, err)
+		}
+	}
+	if devices := reload(); devices[1].Alias != "" {
+		t.Errorf("a rejected alias was saved: %+v", devices[1])
+	}
+}
+
+// TestDeviceStoreReconcile verifies that saved devices found at a new address by a scan are updated.
+func TestDeviceStoreReconcile(t *testing.T) {
+	store, reload := newTestStore(t)
+	for _, device := range []model.Device{
+		{AddrV4: "192.168.1.20", Alias: "garage-pi", MAC: "b8:27:eb:12:34:56", User: "pi"},
+		{AddrV4: "192.168.1.30", Hostname: "printer"},
+		{AddrV4: "192.168.1.40", HostKey: "SHA256:abc"},
+		{AddrV4: "192.168.1.50", Hostname: "nas"},
+	} {
+		if _, err := store.Add(device); err != nil {
+			t.Fatalf("Add(%s) failed with %v", device.AddrV4, err)
+		}
+	}
+
+	changes, err := store.Reconcile(map[string]*model.Device{
+		// The Pi has a new lease.
+		"192.168.1.42": {AddrV4: "192.168.1.42", MAC: "B8:27:EB:12:34:56"},
+		// The printer, saved before its MAC address was known, is at the same address.
+		"192.168.1.30": {AddrV4: "192.168.1.30", MAC: "aa:bb:cc:dd:ee:ff", Hostname: "printer."},
+		// A different device now has the address of the third saved device.
+		"192.168.1.40": {AddrV4: "192.168.1.40", HostKey: "SHA256:xyz"},
+		// A different device now has the address of the NAS, saved before its identity was known.
+		"192.168.1.50": {AddrV4: "192.168.1.50", MAC: "11:22:33:44:55:66", Hostname: "laptop", HostKey: "SHA256:def"},
+	})
+	if err != nil {
+		t.Fatalf("Reconcile() failed with %v", err)
+	}
+	if len(changes) != 1 || changes[0].OldAddrV4 != "192.168.1.20" || changes[0].Device.AddrV4 != "192.168.1.42" {
+		t.Errorf("Reconcile() returned %+v", changes)
+	}
+
+	devices := reload()
+	if got := devices[0]; got.AddrV4 != "192.168.1.42" || got.Alias != "garage-pi" || got.User != "pi" || got.ID != "mac:b8:27:eb:12:34:56" {
+		t.Errorf("unexpected saved Pi: %+v", got)
+	}
+	if got := devices[1]; got.MAC != "aa:bb:cc:dd:ee:ff" || got.ID != "mac:aa:bb:cc:dd:ee:ff" {
+		t.Errorf("unexpected saved printer: %+v", got)
+	}
+	if got := devices[2]; got.HostKey != "SHA256:abc" {
+		t.Errorf("a different device at the same address changed the saved device: %+v", got)
+	}
+	if got := devices[3]; got.ID != "" || got.MAC != "" || got.HostKey != "" {
+		t.Errorf("a different device at the same address gave its identity to the saved device: %+v", got)
+	}
+
+	// Adding the Pi again at its new address is recognised as the same device.
+	if added, err := store.Add(model.Device{AddrV4: "192.168.1.42", MAC: "b8:27:eb:12:34:56"}); err != nil || added {
+		t.Errorf("Add() of a saved device = %v, %v, want false, nil", added, err)
+	}
+}
@@ -0,0 +1,141 @@
+package transfer
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// File is an open file that can be read or written from any offset.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+}
+
+// FileSystem is the set of operations needed to copy files to or from a machine,
+// so the same copy logic works in both directions.
+type FileSystem interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.FileInfo, error)
+	Open(name string) (File, error)
+	// OpenFile opens a file for writing with the given os.O_* flags.
+	OpenFile(name string, flag int) (File, error)
+	MkdirAll(name string) error
+	Chmod(name string, mode fs.FileMode) error
+	Glob(pattern string) ([]string, error)
+	Join(elem ...string) string
+	Base(name string) string
+}
+
+// Local returns the file system of this machine.
+func Local() FileSystem {
+	return localFileSystem{}
+}
+
+// Remote returns the file system of a device, accessed over SFTP.
+func Remote(client *sftp.Client) FileSystem {
+	return remoteFileSystem{client: client}
+}
+
+// localFileSystem uses the os package.
+type localFileSystem struct{}
+
+func (localFileSystem) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+func (localFileSystem) ReadDir(name string) ([]fs.FileInfo, error) {
+	entries, err := os.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (localFileSystem) Open(name string) (File, error) { return os.Open(name) }
+
+func (localFileSystem) OpenFile(name string, flag int) (File, error) {
+	return os.OpenFile(name, flag, 0o644)
+}
+
+func (localFileSystem) MkdirAll(name string) error { return os.MkdirAll(name, 0o755) }
+
+func (localFileSystem) Chmod(name string, mode fs.FileMode) error { return os.Chmod(name, mode) }
+
+func (localFileSystem) Glob(pattern string) ([]string, error) { return filepath.Glob(pattern) }
+
+func (localFileSystem) Join(elem ...string) string { return filepath.Join(elem...) }
+
+func (localFileSystem) Base(name string) string { return filepath.Base(name) }
+
+// remoteFileSystem uses an SFTP client. Paths starting with "~/" are relative to the
+// user's home directory, which is where the SFTP server resolves relative paths from.
+type remoteFileSystem struct {
+	client *sftp.Client
+}
+
+func (r remoteFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return r.client.Stat(remotePath(name))
+}
+
+func (r remoteFileSystem) ReadDir(name string) ([]fs.FileInfo, error) {
+	return r.client.ReadDir(remotePath(name))
+}
+
+func (r remoteFileSystem) Open(name string) (File, error) { return r.client.Open(remotePath(name)) }
+
+func (r remoteFileSystem) OpenFile(name string, flag int) (File, error) {
+	return r.client.OpenFile(remotePath(name), flag)
+}
+
+func (r remoteFileSystem) MkdirAll(name string) error { return r.client.MkdirAll(remotePath(name)) }
+
+func (r remoteFileSystem) Chmod(name string, mode fs.FileMode) error {
+	return r.client.Chmod(remotePath(name), mode)
+}
+
+func (r remoteFileSystem) Glob(pattern string) ([]string, error) {
+	return r.client.Glob(remotePath(pattern))
+}
+
+func (remoteFileSystem) Join(elem ...string) string { return path.Join(elem...) }
+
+// Base returns the last element of the path. The home directory, given as "~", has no name of its
+// own in the path, so it is asked of the server.
+func (r remoteFileSystem) Base(name string) string {
+	name = remotePath(name)
+	base := path.Base(name)
+	if base == "." || base == ".." {
+		if real, err := r.client.RealPath(name); err == nil {
+			base = path.Base(real)
+		}
+	}
+	return base
+}
+
+// remotePath turns a "~" prefixed path into one relative to the home directory.
+func remotePath(name string) string {
+	if name == "~" || name == "" {
+		return "."
+	}
+	if rest, found := strings.CutPrefix(name, "~/"); found {
+		if rest == "" {
+			return "."
+		}
+		return rest
+	}
+	return name
+}
@@ -0,0 +1,74 @@
+package transfer
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// progressInterval limits how often the progress line is redrawn.
+const progressInterval = 100 * time.Millisecond
+
+// progress counts the bytes written to it and draws a progress line for a single file.
+type progress struct {
+	w     io.Writer
+	name  string
+	total int64
+	done  int64
+	drawn time.Time
+}
+
+// newProgress starts a progress line for a file of the given size, of which offset bytes are already copied.
+// A nil writer draws nothing.
+func newProgress(w io.Writer, name string, total, offset int64) *progress {
+	return &progress{w: w, name: name, total: total, done: offset}
+}
+
+// Write counts the bytes and redraws the line if it has not been drawn recently.
+func (p *progress) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	if time.Since(p.drawn) >= progressInterval {
+		p.draw()
+	}
+	return len(b), nil
+}
+
+// finish draws the final state of the line and moves on to the next one.
+func (p *progress) finish() {
+	if p.w == nil {
+		return
+	}
+	p.draw()
+	fmt.Fprintln(p.w)
+}
+
+// draw overwrites the current line with the file name, percentage and bytes copied.
+func (p *progress) draw() {
+	if p.w == nil {
+		return
+	}
+	p.drawn = time.Now()
+	percent := int64(100)
+	if p.total > 0 {
+		percent = p.done * 100 / p.total
+	}
+	name := p.name
+	if runes := []rune(name); len(runes) > 40 {
+		name = "..." + string(runes[len(runes)-37:])
+	}
+	fmt.Fprintf(p.w, "\r%-40s %3d%% %10s / %s", name, percent, formatBytes(p.done), formatBytes(p.total))
+}
+
+// formatBytes returns a size in bytes using binary units, e.g. "1.5 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,169 @@
+package transfer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/rs/zerolog/log"
+)
+
+// copyBufferSize is the size of each read and write. SFTP splits large reads and writes into
+// packets that are sent concurrently, so a large buffer keeps the connection busy.
+const copyBufferSize = 1 << 20
+
+// Options controls how files are copied.
+type Options struct {
+	// Recursive copies directories and everything in them.
+	Recursive bool
+	// Resume continues a file from the end of a shorter copy at the target, rather than starting again.
+	// A target that is already the same size as the source is skipped.
+	Resume bool
+	// Progress receives a progress line for each file. Nothing is drawn when it is nil.
+	Progress io.Writer
+}
+
+// Copy copies the sources from one file system to the target on another, like scp. Sources that do
+// not exist are expanded as glob patterns, so "logs/*.txt" can match files on a device. When the
+// target is an existing directory, each source is copied into it, otherwise a single source is
+// copied to the target path. The permission bits of every file and directory are preserved.
+// Copying carries on after a failure, and every failure is returned.
+func Copy(src FileSystem, sources []string, dst FileSystem, target string, opts Options) error {
+	paths, err := expandSources(src, sources)
+	if err != nil {
+		return err
+	}
+
+	targetInfo, err := dst.Stat(target)
+	targetIsDir := err == nil && targetInfo.IsDir()
+	if len(paths) > 1 && !targetIsDir {
+		return fmt.Errorf("target '%s' must be an existing directory when copying more than one file", target)
+	}
+
+	var errs []error
+	for _, from := range paths {
+		to := target
+		if targetIsDir {
+			to = dst.Join(target, src.Base(from))
+		}
+		if err := copyPath(src, from, dst, to, opts); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// expandSources returns the sources, with any that do not exist replaced by the paths they match as a glob.
+func expandSources(fsys FileSystem, sources []string) ([]string, error) {
+	var paths []string
+	for _, source := range sources {
+		if _, err := fsys.Stat(source); err == nil {
+			paths = append(paths, source)
+			continue
+		}
+		matches, err := fsys.Glob(source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %w", source, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("'%s': %w", source, fs.ErrNotExist)
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// copyPath copies a single file, or a directory when copying recursively.
+func copyPath(src FileSystem, from string, dst FileSystem, to string, opts Options) error {
+	info, err := src.Stat(from)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.IsDir():
+		if !opts.Recursive {
+			return fmt.Errorf("'%s' is a directory, use --recursive to copy it", from)
+		}
+		return copyDir(src, from, info, dst, to, opts)
+	case info.Mode().IsRegular():
+		return copyFile(src, from, info, dst, to, opts)
+	default:
+		return fmt.Errorf("'%s' is not a regular file, skipping it", from)
+	}
+}
+
+// copyDir copies a directory and everything in it.
+func copyDir(src FileSystem, from string, info fs.FileInfo, dst FileSystem, to string, opts Options) error {
+	if err := dst.MkdirAll(to); err != nil {
+		return fmt.Errorf("failed to create directory '%s': %w", to, err)
+	}
+	entries, err := src.ReadDir(from)
+	if err != nil {
+		return fmt.Errorf("failed to read directory '%s': %w", from, err)
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		if err := copyPath(src, src.Join(from, entry.Name()), dst, dst.Join(to, entry.Name()), opts); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	// The mode is set last, so a read-only directory can still be filled.
+	if err := dst.Chmod(to, info.Mode().Perm()); err != nil {
+		errs = append(errs, fmt.Errorf("failed to set mode of '%s': %w", to, err))
+	}
+	return errors.Join(errs...)
+}
+
+// copyFile copies a regular file, resuming from the end of a shorter existing copy if asked to.
+func copyFile(src FileSystem, from string, info fs.FileInfo, dst FileSystem, to string, opts Options) error {
+	var offset int64
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if opts.Resume {
+		if existing, err := dst.Stat(to); err == nil && existing.Mode().IsRegular() {
+			switch {
+			case existing.Size() == info.Size():
+				log.Debug().Msgf("'%s' is already complete, skipping it.", to)
+				return dst.Chmod(to, info.Mode().Perm())
+			case existing.Size() < info.Size():
+				offset = existing.Size()
+				flag = os.O_WRONLY
+			}
+		}
+	}
+
+	in, err := src.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := dst.OpenFile(to, flag)
+	if err != nil {
+		return fmt.Errorf("failed to create '%s': %w", to, err)
+	}
+
+	if offset > 0 {
+		if _, err := in.Seek(offset, io.SeekStart); err != nil {
+			out.Close()
+			return err
+		}
+		if _, err := out.Seek(offset, io.SeekStart); err != nil {
+			out.Close()
+			return err
+		}
+	}
+
+	bar := newProgress(opts.Progress, from, info.Size(), offset)
+	// The reader and writer are wrapped so io.CopyBuffer uses our buffer size rather than their own copy methods.
+	_, err = io.CopyBuffer(struct{ io.Writer }{out}, struct{ io.Reader }{io.TeeReader(in, bar)}, make([]byte, copyBufferSize))
+	bar.finish()
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy '%s' to '%s': %w", from, to, err)
+	}
+	return dst.Chmod(to, info.Mode().Perm())
+}
@@ -0,0 +1,158 @@
+package transfer
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/pkg/sftp"
+)
+
+// writeFile creates a file with the given contents and mode, creating its directory if needed.
+func writeFile(t *testing.T, path, contents string, mode os.FileMode) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(contents), mode); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatalf("failed to set mode: %v", err)
+	}
+}
+
+// readFile returns the contents of a file, failing the test if it cannot be read.
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	return string(data)
+}
+
+// TestCopyRecursive verifies that directories are copied into an existing target with their modes preserved.
+func TestCopyRecursive(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(src, "firmware", "app.bin"), "binary", 0o644)
+	writeFile(t, filepath.Join(src, "firmware", "scripts", "flash.sh"), "#!/bin/sh", 0o755)
+
+	err := Copy(Local(), []string{filepath.Join(src, "firmware")}, Local(), dst, Options{})
+	if err == nil {
+		t.Fatalf("directory was copied without Recursive")
+	}
+
+	if err := Copy(Local(), []string{filepath.Join(src, "firmware")}, Local(), dst, Options{Recursive: true}); err != nil {
+		t.Fatalf("Copy() failed with %v", err)
+	}
+	if got := readFile(t, filepath.Join(dst, "firmware", "app.bin")); got != "binary" {
+		t.Errorf("unexpected contents %q", got)
+	}
+	script := filepath.Join(dst, "firmware", "scripts", "flash.sh")
+	if got := readFile(t, script); got != "#!/bin/sh" {
+		t.Errorf("unexpected contents %q", got)
+	}
+	if runtime.GOOS != "windows" {
+		if info, _ := os.Stat(script); info.Mode().Perm() != 0o755 {
+			t.Errorf("mode was not preserved, got %v", info.Mode().Perm())
+		}
+	}
+}
+
+// TestCopyGlob verifies that a source that does not exist is expanded as a glob pattern.
+func TestCopyGlob(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(src, "a.log"), "a", 0o644)
+	writeFile(t, filepath.Join(src, "b.log"), "b", 0o644)
+	writeFile(t, filepath.Join(src, "c.txt"), "c", 0o644)
+
+	if err := Copy(Local(), []string{filepath.Join(src, "*.log")}, Local(), dst, Options{}); err != nil {
+		t.Fatalf("Copy() failed with %v", err)
+	}
+	entries, _ := os.ReadDir(dst)
+	if len(entries) != 2 || entries[0].Name() != "a.log" || entries[1].Name() != "b.log" {
+		t.Errorf("unexpected files copied: %v", entries)
+	}
+
+	if err := Copy(Local(), []string{filepath.Join(src, "*.bin")}, Local(), dst, Options{}); err == nil {
+		t.Errorf("a pattern that matches nothing did not fail")
+	}
+	if err := Copy(Local(), []string{filepath.Join(src, "*.log")}, Local(), filepath.Join(dst, "a.log"), Options{}); err == nil {
+		t.Errorf("copying several files to a file did not fail")
+	}
+}
+
+// TestCopyResume verifies that a partial copy is continued rather than restarted.
+func TestCopyResume(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(src, "image.bin"), "0123456789", 0o644)
+	// The partial copy has a different first byte, so a restart would be noticed.
+	writeFile(t, filepath.Join(dst, "image.bin"), "X1234", 0o644)
+
+	if err := Copy(Local(), []string{filepath.Join(src, "image.bin")}, Local(), dst, Options{Resume: true}); err != nil {
+		t.Fatalf("Copy() failed with %v", err)
+	}
+	if got := readFile(t, filepath.Join(dst, "image.bin")); got != "X123456789" {
+		t.Errorf("unexpected contents after resume %q", got)
+	}
+
+	if err := Copy(Local(), []string{filepath.Join(src, "image.bin")}, Local(), dst, Options{}); err != nil {
+		t.Fatalf("Copy() failed with %v", err)
+	}
+	if got := readFile(t, filepath.Join(dst, "image.bin")); got != "0123456789" {
+		t.Errorf("unexpected contents after copy %q", got)
+	}
+}
+
+// TestRemotePath verifies that "~" paths are made relative to the home directory.
+func TestRemotePath(t *testing.T) {
+	tests := map[string]string{
+		"~":            ".",
+		"~/":           ".",
+		"~/logs/a.txt": "logs/a.txt",
+		"/var/log":     "/var/log",
+		"logs":         "logs",
+	}
+	for input, want := range tests {
+		if got := remotePath(input); got != want {
+			t.Errorf("remotePath(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+// TestCopyRemoteHome verifies that pulling "~" copies into a directory named after the remote home
+// directory, rather than one named "~".
+func TestCopyRemoteHome(t *testing.T) {
+	home, dst := filepath.Join(t.TempDir(), "pi"), t.TempDir()
+	writeFile(t, filepath.Join(home, "notes.txt"), "notes", 0o644)
+
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{serverReader, serverWriter}, sftp.WithServerWorkingDirectory(home))
+	if err != nil {
+		t.Fatalf("failed to start SFTP server: %v", err)
+	}
+	go func() { _ = server.Serve() }()
+	client, err := sftp.NewClientPipe(clientReader, clientWriter)
+	if err != nil {
+		t.Fatalf("failed to start SFTP client: %v", err)
+	}
+	// Closing the server first ends the client's reads, so the client can then close.
+	t.Cleanup(func() {
+		_ = server.Close()
+		_ = client.Close()
+	})
+
+	if err := Copy(Remote(client), []string{"~"}, Local(), dst, Options{Recursive: true}); err != nil {
+		t.Fatalf("Copy() failed with %v", err)
+	}
+	if got := readFile(t, filepath.Join(dst, "pi", "notes.txt")); got != "notes" {
+		t.Errorf("unexpected contents %q", got)
+	}
+}
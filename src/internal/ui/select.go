@@ -2,6 +2,7 @@ package ui
 
 import (
 	"errors"
+	"sync"
 
 	"github.com/manifoldco/promptui"
 	"github.com/rs/zerolog/log"
@@ -14,18 +15,27 @@ import (
 func CreateInteractiveSelect(iotDevices map[string]*model.Device) (*model.Device, error) {
 	templates := &promptui.SelectTemplates{
 		Label:    "{{ . }}",
-		Active:   "> {{ .AddrV4 | cyan }}\t{{ if .CanConnectSSH }}{{ \"SSH OK\" | green }}{{ end }}\t{{ if ne .Hostname \"\" }}{{ .Hostname | magenta }}{{ end }}",
-		Inactive: "  {{ .AddrV4 | faint }}\t{{ if .CanConnectSSH }}{{ \"SSH OK\" | green }}{{ end }}\t{{ if ne .Hostname \"\" }}{{ .Hostname | magenta }}{{ end }}",
-		Selected: "> You selected {{ .AddrV4 | blue }}{{ if .CanConnectSSH }} {{ \"SSH OK\" | green }}{{ end }}{{ if ne .Hostname \"\" }} {{ .Hostname | magenta }}{{ end }}",
+		Active:   "> {{ .AddrV4 | cyan }}\t{{ if .CanConnectSSH }}{{ \"SSH OK\" | green }}{{ end }}\t{{ if ne .Hostname \"\" }}{{ .Hostname | magenta }}{{ end }}\t{{ if .Vendor }}{{ .Vendor | yellow }}{{ end }}{{ if .Unknown }}\t{{ \"UNKNOWN\" | red | bold }}{{ end }}",
+		Inactive: "  {{ .AddrV4 | faint }}\t{{ if .CanConnectSSH }}{{ \"SSH OK\" | green }}{{ end }}\t{{ if ne .Hostname \"\" }}{{ .Hostname | magenta }}{{ end }}\t{{ if .Vendor }}{{ .Vendor | yellow }}{{ end }}{{ if .Unknown }}\t{{ \"UNKNOWN\" | red | bold }}{{ end }}",
+		Selected: "> You selected {{ .AddrV4 | blue }}{{ if .CanConnectSSH }} {{ \"SSH OK\" | green }}{{ end }}{{ if ne .Hostname \"\" }} {{ .Hostname | magenta }}{{ end }}{{ if .Vendor }} {{ .Vendor | yellow }}{{ end }}{{ if .Unknown }} {{ \"UNKNOWN\" | red | bold }}{{ end }}",
 		Details: `
 Total IOT Devices found: {{ .Total }}
 --------- Device Details ----------
 {{ "IPv4 Address:" | faint }}	{{ .AddrV4 }}
 {{ "IPv6 Address:" | faint }}	{{ if .AddrV6 }}{{ .AddrV6 }}{{ else }}N/A{{ end }}
 {{ "MAC Address:" | faint }}	{{ if .MAC }}{{ .MAC }}{{ else }}N/A{{ end }}
+{{ "Vendor:" | faint }}	{{ if .Vendor }}{{ .Vendor | yellow }}{{ else }}N/A{{ end }}
 {{ "Hostname:" | faint }}	{{ if ne .Hostname "" }}{{ .Hostname | magenta }}{{ else }}N/A{{ end }}
-{{ "SSH Ready:" | faint }}	{{ if .CanConnectSSH }}{{ "SSH OK" | green }}{{ else }}N/A{{ end }}
-{{ "Sources:" | faint }}	{{ .Sources }}`,
+{{ if .Unknown }}{{ "Baseline:" | faint }}	{{ "Not in the baseline" | red }}
+{{ end }}{{ if .Alias }}{{ "Alias:" | faint }}	{{ .Alias | magenta }}
+{{ end }}{{ if .Tags }}{{ "Tags:" | faint }}	{{ .Tags }}
+{{ end }}{{ "SSH Ready:" | faint }}	{{ if .CanConnectSSH }}{{ "SSH OK" | green }} (port {{ .SSHPort }}){{ else }}N/A{{ end }}
+{{ "Open Ports:" | faint }}	{{ if .Banners }}{{ range .Banners }}
+  {{ .Port }}/{{ .Protocol | cyan }}	{{ .Banner }}{{ if .Title }} "{{ .Title }}"{{ end }}{{ end }}{{ else if .OpenPorts }}{{ .OpenPorts }}{{ else }}N/A{{ end }}
+{{ "Sources:" | faint }}	{{ .Sources }}
+{{ "UPnP:" | faint }}	{{ if .UPnP }}{{ .UPnP.FriendlyName }} - {{ .UPnP.Manufacturer }} {{ .UPnP.ModelName }} {{ .UPnP.ModelNumber }}{{ if .UPnP.SerialNumber }} (serial {{ .UPnP.SerialNumber }}){{ end }}{{ else }}N/A{{ end }}
+{{ "Services:" | faint }}	{{ if .Services }}{{ range .Services }}
+  {{ .Type | cyan }}	{{ .Instance }} (port {{ .Port }}){{ end }}{{ else }}N/A{{ end }}`,
 	}
 
 	totalDevices := len(iotDevices)
@@ -40,7 +50,7 @@ Total IOT Devices found: {{ .Total }}
 	}
 
 	prompt := promptui.Select{
-		Label:     "    IPv4\t\tSSH\tHostname",
+		Label:     "    IPv4\t\tSSH\tHostname\tVendor",
 		Items:     selectItems,
 		Templates: templates,
 		Size:      10,
@@ -59,9 +69,15 @@ Total IOT Devices found: {{ .Total }}
 	return selectItems[i].Device, nil
 }
 
+// promptMu makes prompts from concurrent connections, such as those of the fanout command, take turns.
+var promptMu sync.Mutex
+
 // GetPromptInput displays a prompt to the user and returns the entered string.
 // It can optionally mask the input, which is useful for passwords.
 func GetPromptInput(label string, mask rune) (string, error) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
 	prompt := promptui.Prompt{
 		Label:       label,
 		HideEntered: true,
@@ -71,3 +87,21 @@ func GetPromptInput(label string, mask rune) (string, error) {
 	}
 	return prompt.Run()
 }
+
+// Confirm asks the user a yes or no question, defaulting to no. It returns false when the user declines.
+func Confirm(label string) (bool, error) {
+	promptMu.Lock()
+	defer promptMu.Unlock()
+
+	prompt := promptui.Prompt{
+		Label:     label,
+		IsConfirm: true,
+	}
+	if _, err := prompt.Run(); err != nil {
+		if err == promptui.ErrAbort {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
@@ -2,8 +2,47 @@
 
 package ui
 
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
 // This is a no operation function that is built into the application for non-Windows systems.
 // This is handled by the build tag at the top.
 func InitTerminal() func() {
 	return func() {}
-}
\ No newline at end of file
+}
+
+// WatchTerminalSize calls onResize with the new width and height whenever the terminal behind fd
+// changes size, until the returned stop function is called. Unix systems send the SIGWINCH signal
+// when a terminal is resized, so the size is only read when that signal arrives.
+func WatchTerminalSize(fd int, onResize func(width, height int)) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+	done := make(chan struct{})
+
+	go func() {
+		width, height, _ := term.GetSize(fd)
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				newWidth, newHeight, err := term.GetSize(fd)
+				if err != nil || (newWidth == width && newHeight == height) {
+					continue
+				}
+				width, height = newWidth, newHeight
+				onResize(width, height)
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
@@ -4,11 +4,16 @@ package ui
 
 import (
 	"os"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"golang.org/x/sys/windows"
+	"golang.org/x/term"
 )
 
+// resizePollInterval is how often the console size is checked for changes.
+const resizePollInterval = 250 * time.Millisecond
+
 // This function is built for windows applications only
 // This function is to enable ANSI/VT100 escape code processing in the Windows console
 func InitTerminal() (cleanup func()) {
@@ -44,3 +49,33 @@ func InitTerminal() (cleanup func()) {
 
 	return
 }
+
+// WatchTerminalSize calls onResize with the new width and height whenever the console behind fd
+// changes size, until the returned stop function is called. Windows has no resize signal, so the
+// console size is polled instead.
+func WatchTerminalSize(fd int, onResize func(width, height int)) (stop func()) {
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(resizePollInterval)
+		defer ticker.Stop()
+		width, height, _ := term.GetSize(fd)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				newWidth, newHeight, err := term.GetSize(fd)
+				if err != nil || (newWidth == width && newHeight == height) {
+					continue
+				}
+				width, height = newWidth, newHeight
+				onResize(width, height)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,129 @@
+package watch
+
+import (
+	"fmt"
+	"time"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// The kinds of event reported between rounds of a watch.
+const (
+	Joined = "joined"
+	Left   = "left"
+	Moved  = "moved"
+)
+
+// Event is a change to the devices on the network, seen between two rounds of scanning.
+type Event struct {
+	Time   time.Time    `json:"time"`
+	Kind   string       `json:"event"`
+	Device model.Device `json:"device"`
+	// OldAddrV4 is the address a device that moved had before.
+	OldAddrV4 string `json:"oldAddrV4,omitempty"`
+}
+
+// String describes the event on a single line, e.g. "joined 192.168.1.50 (aa:bb:cc:dd:ee:ff, Espressif Inc.)".
+func (e Event) String() string {
+	name := e.Device.Name()
+	if name != e.Device.AddrV4 {
+		name += " (" + e.Device.AddrV4 + ")"
+	}
+	switch e.Kind {
+	case Moved:
+		return fmt.Sprintf("%s %s, was %s", e.Kind, name, e.OldAddrV4)
+	case Joined:
+		if e.Device.MAC != "" {
+			vendor := e.Device.Vendor
+			if vendor == "" {
+				vendor = "unknown vendor"
+			}
+			return fmt.Sprintf("%s %s, %s %s", e.Kind, name, e.Device.MAC, vendor)
+		}
+	}
+	return e.Kind + " " + name
+}
+
+// trackedDevice is a device the tracker has seen, with the number of rounds in a row it has been missing from.
+type trackedDevice struct {
+	device model.Device
+	missed int
+}
+
+// Tracker keeps the last known state of the devices on the network across rounds of scanning, and
+// reports the devices that join, leave or change address. Devices are matched between rounds by
+// model.FindSameDevice, so a device given a new address by DHCP is reported as moving rather than
+// as leaving and joining. Scans miss devices now and then, for example when a device is asleep, so
+// a device only counts as having left after it has been missing for a number of rounds in a row.
+type Tracker struct {
+	missedRounds int
+	devices      []trackedDevice
+	started      bool
+}
+
+// NewTracker returns a tracker that reports a device as having left after it is missing from missedRounds rounds in a row.
+func NewTracker(missedRounds int) *Tracker {
+	return &Tracker{missedRounds: max(missedRounds, 1)}
+}
+
+// Update records the devices found by a round of scanning at the given time, and returns the events
+// since the previous round. The first round sets the starting state, so it reports no events.
+func (t *Tracker) Update(found []model.Device, now time.Time) []Event {
+	var events []Event
+	seen := make([]bool, len(t.devices))
+	known := make([]model.Device, len(t.devices))
+	for i, tracked := range t.devices {
+		known[i] = tracked.device
+	}
+
+	for _, device := range found {
+		match := model.FindSameDevice(known, &device)
+		if match == nil {
+			t.devices = append(t.devices, trackedDevice{device: device})
+			if t.started {
+				events = append(events, Event{Time: now, Kind: Joined, Device: device})
+			}
+			continue
+		}
+		i := indexOf(known, match)
+		if seen[i] {
+			continue
+		}
+		seen[i] = true
+		if match.AddrV4 != device.AddrV4 {
+			events = append(events, Event{Time: now, Kind: Moved, Device: device, OldAddrV4: match.AddrV4})
+		}
+		t.devices[i] = trackedDevice{device: device}
+	}
+
+	// Devices that are still missing after enough rounds have left. Those found this round were appended after the known devices.
+	remaining := t.devices[:0]
+	for i, tracked := range t.devices {
+		if i < len(seen) && !seen[i] {
+			tracked.missed++
+			if tracked.missed >= t.missedRounds {
+				events = append(events, Event{Time: now, Kind: Left, Device: tracked.device})
+				continue
+			}
+		}
+		remaining = append(remaining, tracked)
+	}
+	t.devices = remaining
+	t.started = true
+	return events
+}
+
+// Len returns the number of devices currently on the network, including those missing for fewer rounds than it takes to leave.
+func (t *Tracker) Len() int {
+	return len(t.devices)
+}
+
+// indexOf returns the index of the element of devices that device points to.
+func indexOf(devices []model.Device, device *model.Device) int {
+	for i := range devices {
+		if &devices[i] == device {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,47 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"com.bradleytenuta/idiot/internal/model"
+)
+
+// TestTracker verifies the events reported over several rounds of scanning.
+func TestTracker(t *testing.T) {
+	pi := model.Device{AddrV4: "192.168.1.20", MAC: "b8:27:eb:12:34:56", Hostname: "raspberrypi"}
+	printer := model.Device{AddrV4: "192.168.1.30", Hostname: "printer"}
+	rogue := model.Device{AddrV4: "192.168.1.66", MAC: "de:ad:be:ef:00:01", Vendor: "Espressif Inc."}
+	movedPi := pi
+	movedPi.AddrV4 = "192.168.1.42"
+
+	tracker := NewTracker(2)
+	now := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+	rounds := []struct {
+		found []model.Device
+		want  []string
+	}{
+		{found: []model.Device{pi, printer}, want: nil},
+		{found: []model.Device{pi, printer, rogue}, want: []string{"joined 192.168.1.66, de:ad:be:ef:00:01 Espressif Inc."}},
+		// The printer is missed once, which is not enough to leave.
+		{found: []model.Device{movedPi, rogue}, want: []string{"moved raspberrypi (192.168.1.42), was 192.168.1.20"}},
+		{found: []model.Device{movedPi, printer, rogue}, want: nil},
+		{found: []model.Device{movedPi}, want: nil},
+		{found: []model.Device{movedPi}, want: []string{"left printer (192.168.1.30)", "left 192.168.1.66"}},
+		{found: []model.Device{movedPi, printer}, want: []string{"joined printer (192.168.1.30)"}},
+	}
+	for i, round := range rounds {
+		events := tracker.Update(round.found, now)
+		if len(events) != len(round.want) {
+			t.Fatalf("round %d: got events %v, want %v", i+1, events, round.want)
+		}
+		for j, event := range events {
+			if event.String() != round.want[j] || !event.Time.Equal(now) {
+				t.Errorf("round %d: event %d = %q at %s, want %q", i+1, j, event, event.Time, round.want[j])
+			}
+		}
+	}
+	if got := tracker.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2", got)
+	}
+}